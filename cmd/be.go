@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 
@@ -12,38 +14,100 @@ import (
 	"be/tok"
 )
 
-var shouldServe = flag.Bool("serve", false, "serve generated output on :8080")
+var (
+	shouldServe = flag.Bool("serve", false, "serve generated output on :8080")
+	siteFile = flag.String("site", "site.be", "site configuration, defaults are used if the file does not exist")
+	strict = flag.Bool("strict", false, "treat warnings as errors")
+	maxErrors = flag.Int("max-errors", tok.DefaultMaxErrors, "number of syntax errors to report before giving up")
+)
 
 func init() {
 	flag.Parse()
 }
 
+func isFlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
 func main() {
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "fmt":
+			os.Exit(runFmt(flag.Args()[1:]))
+		case "lsp":
+			os.Exit(runLSP(flag.Args()[1:]))
+		case "doc":
+			os.Exit(runDoc(flag.Args()[1:]))
+		}
+	}
+
 	//tokenizer := tok.NewTokenizer([]rune(testInput2))
-	content := Must(os.ReadFile("blog_example.be"))
-	_ = content
-	tokenizer := tok.NewTokenizer([]rune(string(content)))
-	tokens := Must(tokenizer.Tokenize())
+	sources := tok.NewSources()
+	fileName := "blog_example.be"
+	if flag.NArg() > 0 {
+		fileName = flag.Arg(0)
+	}
+	var content []byte
+	if fileName == "-" {
+		fileName = "<stdin>"
+		content = Must(io.ReadAll(os.Stdin))
+	} else {
+		content = Must(os.ReadFile(fileName))
+	}
+	tokenizer := tok.NewSourceTokenizer(fileName, []rune(string(content)), sources)
+	tokenizer.Recover = true
+	tokenizer.MaxErrors = *maxErrors
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 	for _, t := range tokens {
 		fmt.Println(t)
 	}
 	fmt.Println("---------------")
-	root := lex.Lex(tokens)
+	root, err := lex.Lex(tokens)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 	fmt.Printf("%s\n", root)
 
-	blog := &Blog{}
+	site := DefaultSite
+	if _, err := os.Stat(*siteFile); err == nil || isFlagSet("site") {
+		site, err = LoadSite(*siteFile, sources)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading site configuration: %v\n%s", err, trace(err))
+			os.Exit(1)
+		}
+	}
+
+	blog := NewBlog(site)
 	scopes := InitScopes(blog)
-	if err := blog.Eval(scopes, root.First); err != nil {
-		fmt.Printf("error evaluating blog: %v", err)
-		return
+	scopes.Sources = sources
+	scopes.Diagnostics = &Diagnostics{Strict: *strict}
+	evalErr := blog.Eval(scopes, root.First)
+	for _, diag := range scopes.Diagnostics.List {
+		fmt.Fprintf(os.Stderr, "%v\n%s", diag, trace(diag))
+	}
+	if evalErr != nil {
+		fmt.Fprintf(os.Stderr, "error evaluating blog: %v\n%s", evalErr, trace(evalErr))
+		os.Exit(1)
+	}
+	if n := scopes.Diagnostics.Count(SeverityError); n > 0 {
+		fmt.Fprintf(os.Stderr, "error evaluating blog: %d error(s)\n", n)
+		os.Exit(1)
 	}
 	blogHtml, err := String(blog)
 	if err != nil {
-		fmt.Printf("error generating html: %v", err)
-		return
+		fmt.Fprintf(os.Stderr, "error generating html: %v\n", err)
+		os.Exit(1)
 	}
 	fmt.Println(blogHtml)
-	PanicIf(os.WriteFile("out.html", []byte(blogHtml), 0644))
+	PanicIf(os.WriteFile(blog.Site.OutputPath(fileName), []byte(blogHtml), 0644))
 
 	if *shouldServe {
 		http.Handle("/fonts/", http.StripPrefix("/fonts/", http.FileServer(http.Dir("fonts"))))
@@ -52,3 +116,13 @@ func main() {
 		http.ListenAndServe(":8080", nil)
 	}
 }
+
+// trace returns the forms that were being evaluated when err occurred, as
+// an indented line.
+func trace(err error) string {
+	var evalErr EvalError
+	if !errors.As(err, &evalErr) || evalErr.Trace() == "" {
+		return ""
+	}
+	return fmt.Sprintf("\tin %s\n", evalErr.Trace())
+}
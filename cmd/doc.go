@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"be"
+)
+
+// runDoc implements `be doc [-html] [form ...]`, which prints the reference
+// of the given forms (or all of them), generated from their signatures.
+func runDoc(args []string) (exitCode int) {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	asHTML := flags.Bool("html", false, "render the reference as HTML page")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: be doc [-html] [form ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var sigs []be.Signature
+	if flags.NArg() == 0 {
+		for _, sig := range be.Forms() {
+			if !sig.Internal {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	for _, name := range flags.Args() {
+		sig, ok := be.LookupForm(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "doc: no such form: %s\n", name)
+			exitCode = 1
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+	if *asHTML {
+		if err := docTemplate.Execute(os.Stdout, sigs); err != nil {
+			fmt.Fprintf(os.Stderr, "doc: %v\n", err)
+			return 1
+		}
+		return exitCode
+	}
+	for i, sig := range sigs {
+		if i > 0 {
+			fmt.Println()
+		}
+		writeDoc(os.Stdout, sig)
+	}
+	return exitCode
+}
+
+func writeDoc(w io.Writer, sig be.Signature) {
+	fmt.Fprintf(w, "%s\n\t%s\n", sig.Usage, sig.Doc)
+	if len(sig.Params)+len(sig.Keywords) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, param := range sig.Params {
+		fmt.Fprintf(w, "\t%-24s%s\n", paramName(param), param.Type)
+	}
+	for _, kw := range sig.Keywords {
+		fmt.Fprintf(w, "\t%-24s%s\n", keywordName(kw), kw.Doc)
+	}
+	if len(sig.Parents) > 0 {
+		fmt.Fprintf(w, "\n\tonly within: %s\n", strings.Join(sig.Parents, ", "))
+	}
+}
+
+// paramName returns the name of a parameter as it is shown in the reference.
+func paramName(param be.Param) string {
+	name := param.Name
+	if param.Variadic {
+		name += "..."
+	}
+	if param.Optional {
+		name = "[" + name + "]"
+	}
+	return name
+}
+
+func keywordName(kw be.Param) string {
+	if kw.Default != "" {
+		return fmt.Sprintf(":%s (default %s)", kw.Name, kw.Default)
+	}
+	return ":" + kw.Name
+}
+
+var docTemplate = template.Must(template.New("doc").Funcs(template.FuncMap{
+	"param": paramName,
+	"keyword": keywordName,
+}).Parse(HtmlDoc))
+
+const HtmlDoc = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="utf-8" />
+		<meta name="viewport" content="width=device-width, initial-scale=1.0" />
+		<link rel="stylesheet" href="/public/styles.css" />
+		<title>Form Reference</title>
+	</head>
+	<body>
+		<main>
+			<article class="form-reference">
+				<h1>Form Reference</h1>
+				<nav>
+				{{- range .}}
+					<a href="#{{.Name}}"><code>{{.Name}}</code></a>
+				{{- end}}
+				</nav>
+				{{- range .}}
+				<section id="{{.Name}}">
+					<h2><code>{{.Name}}</code></h2>
+					<pre><code>{{.Usage}}</code></pre>
+					<p>{{.Doc}}</p>
+					{{- if or .Params .Keywords}}
+					<dl>
+						{{- range .Params}}
+						<dt><code>{{param .}}</code></dt>
+						<dd>{{.Type}}</dd>
+						{{- end}}
+						{{- range .Keywords}}
+						<dt><code>{{keyword .}}</code></dt>
+						<dd>{{.Doc}}</dd>
+						{{- end}}
+					</dl>
+					{{- end}}
+					{{- if .Parents}}
+					<p><small>Only within: {{range $i, $p := .Parents}}{{if $i}}, {{end}}<a href="#{{$p}}"><code>{{$p}}</code></a>{{end}}</small></p>
+					{{- end}}
+				</section>
+				{{- end}}
+			</article>
+		</main>
+	</body>
+</html>
+`
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"be/format"
+	"be/internal/diff"
+)
+
+// runFmt implements `be fmt [-l] [-d] [-w] [path ...]`, which works like
+// gofmt: files are formatted to stdout, directories are searched for .be
+// files, and without any path, stdin is formatted.
+func runFmt(args []string) (exitCode int) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := flags.Bool("l", false, "list files whose formatting differs from be fmt's")
+	showDiff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	write := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: be fmt [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	report := func(err error) {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exitCode = 2
+	}
+	if flags.NArg() == 0 {
+		if *write {
+			report(fmt.Errorf("cannot use -w with standard input"))
+			return exitCode
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			report(err)
+			return exitCode
+		}
+		if err := formatFile("<stdin>", src, *list, *showDiff, false); err != nil {
+			report(err)
+		}
+		return exitCode
+	}
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// like gofmt, skip test data, which is kept as written
+			if d.IsDir() && path != root && d.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			if d.IsDir() || (path != root && filepath.Ext(path) != ".be") {
+				return nil
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := formatFile(path, src, *list, *showDiff, *write); err != nil {
+				report(err)
+			}
+			return nil
+		})
+		if err != nil {
+			report(err)
+		}
+	}
+	return exitCode
+}
+
+func formatFile(name string, src []byte, list, showDiff, write bool) error {
+	res, err := format.Source(name, src)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(src, res) {
+		if !list && !showDiff && !write {
+			os.Stdout.Write(res)
+		}
+		return nil
+	}
+	if list {
+		fmt.Println(name)
+	}
+	if write {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if showDiff {
+		fmt.Print(diff.Unified(name+".orig", name, string(src), string(res)))
+	}
+	if !list && !showDiff && !write {
+		os.Stdout.Write(res)
+	}
+	return nil
+}
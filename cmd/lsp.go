@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"be/lsp"
+)
+
+// runLSP implements `be lsp`, a language server speaking over stdio.
+func runLSP(args []string) (exitCode int) {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: be lsp\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
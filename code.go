@@ -0,0 +1,90 @@
+package be
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"be/internal/highlight"
+)
+
+// parseLineRanges parses ranges like "3-5,8" into a set of line numbers.
+func parseLineRanges(ranges string) (map[int]bool, error) {
+	lines := map[int]bool{}
+	for _, r := range strings.Split(ranges, ",") {
+		from, to, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid line range: %q", r)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(to)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid line range: %q", r)
+			}
+		}
+		for n := first; n <= last; n++ {
+			lines[n] = true
+		}
+	}
+	return lines, nil
+}
+
+// NewCodeBlock highlights src, numbering the lines from start.
+// highlighted are the lines to emphasize, counted from 1.
+func NewCodeBlock(lang, file string, start int, highlighted map[int]bool, src string) *CodeBlock {
+	code := &CodeBlock{
+		Lang: lang,
+		File: file,
+		Source: src,
+	}
+	for i, spans := range highlight.Lines(lang, src) {
+		var sb strings.Builder
+		for _, span := range spans {
+			if span.Class == "" {
+				sb.WriteString(html.EscapeString(span.Text))
+				continue
+			}
+			fmt.Fprintf(&sb, `<span class="hl-%s">%s</span>`, span.Class, html.EscapeString(span.Text))
+		}
+		code.Lines = append(code.Lines, CodeLine{
+			Number: start + i,
+			Highlighted: highlighted[i+1],
+			HTML: template.HTML(sb.String()),
+		})
+	}
+	return code
+}
+
+// codeFun returns a code block.
+//
+//	{code :lang go :file main.go :start 10 :highlight 3-5,8 \+
+//	...
+//	\+}
+func codeFun(blog *Blog, scopes *Scopes, args *Args) error {
+	lang := args.Keyword("lang")
+	if lang.Text != "" && !highlight.Supported(string(lang.Text)) {
+		return fmt.Errorf("%s: code: unsupported language: %s", lang.Pos, string(lang.Text))
+	}
+	file := args.Keyword("file")
+	startArg := args.Keyword("start")
+	start, err := strconv.Atoi(string(startArg.Text))
+	if err != nil {
+		return fmt.Errorf("%s: code: want: start line number, got: %q", startArg.Pos, string(startArg.Text))
+	}
+	ranges := args.Keyword("highlight")
+	highlighted := map[int]bool{}
+	if ranges.Text != "" {
+		highlighted, err = parseLineRanges(string(ranges.Text))
+		if err != nil {
+			return fmt.Errorf("%s: code: %w", ranges.Pos, err)
+		}
+	}
+	text := args.Next()
+	src := strings.TrimSuffix(string(text.Text), "\n")
+	scopes.Parent().Append(NewCodeBlock(string(lang.Text), string(file.Text), start, highlighted, src))
+	return nil
+}
@@ -6,14 +6,16 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"math"
 	"net/http"
-)
+	"strings"
 
-var (
-	pages Template = Template{template.New("")}
-	generatedIDs = map[string]struct{}{}
+	. "be/internal/debug"
+	"be/tok"
 )
 
+var pages Template = Template{template.New("")}
+
 func init() {
 	pages.Funcs(template.FuncMap{
 		"Render": Render,
@@ -26,6 +28,13 @@ func init() {
 	template.Must(pages.Parse(HtmlText))
 	template.Must(pages.Parse(HtmlParagraph))
 	template.Must(pages.Parse(HtmlLink))
+	template.Must(pages.Parse(HtmlAbstract))
+	template.Must(pages.Parse(HtmlImage))
+	template.Must(pages.Parse(HtmlFigure))
+	template.Must(pages.Parse(HtmlList))
+	template.Must(pages.Parse(HtmlDefList))
+	template.Must(pages.Parse(HtmlTable))
+	template.Must(pages.Parse(HtmlFootnote))
 	template.Must(pages.Parse(HtmlAside))
 	template.Must(pages.Parse(HtmlSidenote))
 	template.Must(pages.Parse(HtmlEnquote))
@@ -60,8 +69,34 @@ func Handler(blog *Blog, onError func(error)) http.HandlerFunc {
 	}
 }
 
-func GenerateID(prefix string) (id string) {
-	for _, r := range prefix {
+// GenerateID returns an id derived from prefix, that no other element of
+// the blog has.
+func (blog *Blog) GenerateID(prefix string) string {
+	return blog.UniqueID(Slug(prefix))
+}
+
+// UniqueID returns id, with a numeric suffix if another element of the blog
+// already has it.
+func (blog *Blog) UniqueID(id string) string {
+	if blog.ids == nil {
+		blog.ids = map[string]struct{}{}
+	}
+	return UniqueID(id, blog.ids)
+}
+
+// anchor records that the element with id, which can be linked to (#id), is
+// defined at node.
+func (blog *Blog) anchor(id string, node *Node) string {
+	if blog.Anchors == nil {
+		blog.Anchors = map[string]Anchor{}
+	}
+	blog.Anchors[id] = Anchor{node.Pos, node.End}
+	return id
+}
+
+// Slug converts s into a string usable as an id.
+func Slug(s string) (id string) {
+	for _, r := range s {
 		if 'a' <= r && r <= 'z' {
 			id += string(r)
 		} else if r == ' ' {
@@ -72,14 +107,20 @@ func GenerateID(prefix string) (id string) {
 			id += "_"
 		}
 	}
+	return id
+}
+
+// UniqueID adds a numeric suffix to id if it is already taken, and marks the
+// result as taken.
+func UniqueID(id string, taken map[string]struct{}) string {
 	n, alreadyExists, ext := 1, true, ""
 	for alreadyExists {
-		if _, alreadyExists = generatedIDs[id + ext]; alreadyExists {
+		if _, alreadyExists = taken[id + ext]; alreadyExists {
 			ext = fmt.Sprintf("-%d", n)
 			n++
 		}
 	}
-	generatedIDs[id + ext] = struct{}{}
+	taken[id + ext] = struct{}{}
 	return id + ext
 }
 
@@ -90,6 +131,7 @@ type (
 	CompositeRenderable interface {
 		Renderable
 		Append(child Renderable)
+		Children() []Renderable
 	}
 	TextRenderable interface {
 		Renderable
@@ -99,14 +141,25 @@ type (
 
 type (
 	Blog struct {
-		BlogName string
+		Site Site
 		Title, AltTitle string
 		Author Author
 		Tags Tags
 		Meta Meta
-		Abstract string
+		Abstract *Abstract
 		Languages []Language
 		Content []Renderable
+		Footnotes []*Footnote
+		// Anchors are the ids of the elements that can be linked to, like
+		// sections and figures.
+		Anchors map[string]Anchor
+		figures int // number of figures so far
+		tables int // number of tables so far
+		ids map[string]struct{} // taken by the elements
+	}
+	// Anchor is where an element that can be linked to is defined.
+	Anchor struct {
+		Pos, End tok.Position
 	}
 	Author struct {
 		Name string
@@ -122,10 +175,15 @@ type (
 		CanonicalURL string
 		Description string
 		Published time.Time
-		Revisions []time.Time
+		Revisions []Revision // sorted by date
 		Topic string
 		EstReadingTime ReadingTime
 	}
+	Revision struct {
+		Date time.Time
+		Note string // what changed
+		forms []Frame // evaluating the revised form, errors are reported at it
+	}
 	Tag string
 	Tags []Tag
 	ReadingTime struct {
@@ -145,6 +203,41 @@ func (blog *Blog) Append(child Renderable) {
 	blog.Content = append(blog.Content, child)
 }
 
+func (blog *Blog) Children() []Renderable {
+	return blog.Content
+}
+
+// Summary returns the abstract as plain text, or the description if there is
+// no abstract.
+func (blog *Blog) Summary() string {
+	if blog.Abstract != nil {
+		return PlainText(blog.Abstract)
+	}
+	return blog.Meta.Description
+}
+
+// PlainText returns the text of r without any markup.
+// Sidenotes are flattened to their short text.
+func PlainText(r Renderable) string {
+	var sb strings.Builder
+	var walk func(r Renderable)
+	walk = func(r Renderable) {
+		switch r := r.(type) {
+		case TextRenderable:
+			sb.WriteString(r.Text())
+		case *Sidenote:
+			sb.WriteString(r.ShortText)
+		case CompositeRenderable: // paragraphs, sections, ...
+			for _, child := range r.Children() {
+				walk(child)
+			}
+			sb.WriteString(" ")
+		}
+	}
+	walk(r)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
 func (t Tag) String() string {
 	return ":" + string(t)
 }
@@ -162,13 +255,18 @@ func (ts Tags) KeywordList() (s string) {
 	return s
 }
 
+// IsDraft reports whether the post has not been published yet.
+func (m Meta) IsDraft() bool {
+	return m.Published.IsZero()
+}
+
 func (m Meta) IsRevised() bool {
 	return len(m.Revisions) > 0
 }
 
 func (m Meta) LastRevised() time.Time {
 	if len(m.Revisions) > 0 {
-		return m.Revisions[len(m.Revisions)-1]
+		return m.Revisions[len(m.Revisions)-1].Date
 	}
 	return time.Time{}
 }
@@ -177,11 +275,51 @@ func (m Meta) CopyYear() int {
 	if m.IsRevised() {
 		return m.LastRevised().Year()
 	}
+	if m.IsDraft() {
+		return time.Now().Year()
+	}
 	return m.Published.Year()
 }
 
 func (rt ReadingTime) String() string {
-	return fmt.Sprintf("~%s", rt.Duration.String())
+	return fmt.Sprintf("~%d′", max(1, int(math.Round(rt.Minutes()))))
+}
+
+const (
+	codeWordWeight = 2.0 // code is read slower than prose
+	sidenoteWordWeight = 0.5 // not every reader expands the sidenotes
+)
+
+// EstimateReadingTime counts the words in blog, reading wordsPerMinute.
+func EstimateReadingTime(blog *Blog, wordsPerMinute int) ReadingTime {
+	var count func(r Renderable) float64
+	count = func(r Renderable) (words float64) {
+		switch r := r.(type) {
+		case *CodeBlock:
+			words = codeWordWeight * float64(len(strings.Fields(r.Source)))
+		case TextRenderable:
+			words = float64(len(strings.Fields(r.Text())))
+		case *Sidenote:
+			words = float64(len(strings.Fields(r.ShortText)))
+			for _, child := range r.Children() {
+				words += sidenoteWordWeight * count(child)
+			}
+		case CompositeRenderable:
+			for _, child := range r.Children() {
+				words += count(child)
+			}
+		}
+		return words
+	}
+	words := count(blog)
+	if blog.Abstract != nil {
+		words += count(blog.Abstract)
+	}
+	for _, footnote := range blog.Footnotes {
+		words += count(footnote)
+	}
+	minutes := words / float64(wordsPerMinute)
+	return ReadingTime{time.Duration(minutes * float64(time.Minute))}
 }
 
 const HtmlEntry = `
@@ -194,28 +332,30 @@ const HtmlEntry = `
 		<link rel="stylesheet" href="/public/styles.css" />
 		<link rel="icon" type="image/png" href="/public/favicon.png" />
 		<link rel="canonical" href="{{.Meta.CanonicalURL}}" />
-		<title>{{.Title}} &mdash; ({{.BlogName}})</title>
+		<title>{{.Title}} &mdash; ({{.Site.Name}})</title>
 		<meta name="author" content="{{.Author.Name}}" />
 		<meta name="keywords" content="{{.Tags.KeywordList}}"/>
 		<meta name="description" content="{{.Meta.Description}}"/>
 		{{ if .Meta.IsRevised }}
-		<meta name="revised" content="{{.Meta.LastRevised}}" />
+		<meta name="revised" content="{{.Meta.LastRevised.Format "2006-01-02"}}" />
 		{{ end }}
 		<meta name="topic" content="{{.Meta.Topic}}">
 		<meta name="subject" content="{{.Meta.Topic}}">
 		<meta name="language" content="{{.Meta.Language}}">
-		<meta name="abstract" content="{{.Abstract}}">
-		<meta name="summary" content="{{.Abstract}}">
+		<meta name="abstract" content="{{.Summary}}">
+		<meta name="summary" content="{{.Summary}}">
 		<meta name="url" content="{{.Meta.CanonicalURL}}">
 		<meta name="og:title" content="{{.Title}}"/>
 		<meta name="og:type" content="article"/>
+		{{ if not .Meta.IsDraft }}
 		<meta property="article:published_time" content="{{.Meta.Published.Format "2006-01-02"}}" />
+		{{ end }}
 		{{ if .Meta.IsRevised }}
-		<meta property="article:revised_time" content="{{.Meta.LastRevised}}" />
+		<meta property="article:revised_time" content="{{.Meta.LastRevised.Format "2006-01-02"}}" />
 		{{ end }}
 		<meta name="og:url" content="{{.Meta.CanonicalURL}}"/>
-		<meta name="og:site_name" content="{{.BlogName}}"/>
-		<meta name="og:description" content="{{.Meta.Description}}"/>
+		<meta name="og:site_name" content="{{.Site.Name}}"/>
+		<meta name="og:description" content="{{.Summary}}"/>
 	</head>
 	<body>
 		<div class="scroll-progress">
@@ -225,11 +365,11 @@ const HtmlEntry = `
 			<nav>
 				<p class="fill">
 				<!-- 2^7633587786 -->
-				<code>({{.BlogName}}</code>
+				<code>({{.Site.Name}}</code>
 				<span class="keywords">
-					<code><a href="/index.html">:home</a></code>
-					<code><a href="/about.html">:about</a></code>
-					<code><a href="/rss.xml">:rss</a></code>
+					{{ range .Site.Nav }}
+					<code><a href="{{.URL}}">:{{.Label}}</a></code>
+					{{ end }}
 				</span>
 				<code>)</code>
 				</p>
@@ -241,7 +381,7 @@ const HtmlEntry = `
 					<h1>{{.Title}}</h1>
 					<aside class="content-info">
 						<div class="info">
-							<p class="published-date"><small>{{.Meta.Published.Format "2006-01-02"}}</small></p>
+							<p class="published-date"><small>{{ if .Meta.IsDraft }}Draft{{ else }}{{.Meta.Published.Format "2006-01-02"}}{{ end }}</small></p>
 							<p class="time-est-reading"><small>{{.Meta.EstReadingTime}}</small></p>
 						</div>
 						<div class="taglist">
@@ -260,9 +400,35 @@ const HtmlEntry = `
 						</ul>
 					</li>
 				</ul>
+				{{ with .Abstract }}
+				{{ Render . }}
+				{{ end }}
 				{{ range .Content }}
 					{{ Render . }}
 				{{ end }}
+				{{ if .Footnotes }}
+				<section class="footnotes">
+					<h2>Notes</h2>
+					<ol>
+						{{ range .Footnotes }}
+						{{ Render . }}
+						{{ end }}
+					</ol>
+				</section>
+				{{ end }}
+				{{ if .Meta.IsRevised }}
+				<section class="changelog">
+					<h2>Changelog</h2>
+					<ul>
+						{{ if not .Meta.IsDraft }}
+						<li><time datetime="{{.Meta.Published.Format "2006-01-02"}}">{{.Meta.Published.Format "2006-01-02"}}</time> Published</li>
+						{{ end }}
+						{{ range .Meta.Revisions }}
+						<li><time datetime="{{.Date.Format "2006-01-02"}}">{{.Date.Format "2006-01-02"}}</time> {{.Note}}</li>
+						{{ end }}
+					</ul>
+				</section>
+				{{ end }}
 			</article>
 		</main>
 		<footer>
@@ -307,18 +473,18 @@ const (
 
 var _ CompositeRenderable = (*Section)(nil)
 
-func NewSection(title string) *Section {
+func NewSection(id, title string) *Section {
 	return &Section{
-		ID: GenerateID(title),
+		ID: id,
 		Title: title,
 		Content: []Renderable{},
 		Level: SectionLevelSection,
 	}
 }
 
-func NewSubsection(title string) *Section {
+func NewSubsection(id, title string) *Section {
 	return &Section{
-		ID: GenerateID(title),
+		ID: id,
 		Title: title,
 		Content: []Renderable{},
 		Level: SectionLevelSubsection,
@@ -343,6 +509,10 @@ func (s *Section) Append(child Renderable) {
 	s.Content = append(s.Content, child)
 }
 
+func (s *Section) Children() []Renderable {
+	return s.Content
+}
+
 const HtmlSection = `
 {{ define "Section" }}
 <section id="{{.ID}}">
@@ -381,6 +551,10 @@ func (p *Paragraph) Append(child Renderable) {
 	p.Content = append(p.Content, child)
 }
 
+func (p *Paragraph) Children() []Renderable {
+	return p.Content
+}
+
 const HtmlParagraph = `
 {{ define "Paragraph" }}<p>
 {{ range .Content }}
@@ -409,22 +583,412 @@ const HtmlText = `{{ define "Text" }}{{ . }}{{ end }}`
 type Link struct {
 	Link string
 	External bool
+	Content []Renderable
 }
 
-var _ Renderable = (*Link)(nil)
+var _ CompositeRenderable = (*Link)(nil)
 
-func (l Link) Render() (template.HTML, error) {
+func (l *Link) Render() (template.HTML, error) {
 	buf := &bytes.Buffer{}
 	err := pages.Execute(buf, "Link", l)
 	return template.HTML(buf.String()), err
 }
 
+// URL returns the link, it was validated by NewLink and is safe to use
+// (html/template would reject tel: urls otherwise).
+func (l *Link) URL() template.URL {
+	return template.URL(l.Link)
+}
+
+func (l *Link) Append(child Renderable) {
+	l.Content = append(l.Content, child)
+}
+
+func (l *Link) Children() []Renderable {
+	return l.Content
+}
+
 const HtmlLink = `
-{{ define "Link" }}
-<a href="{{.Link}}" {{ if .External }} target="_blank" {{ end }}>{{.Text}}</a>
+{{ define "Link" }}<a href="{{.URL}}"{{ if .External }} target="_blank" rel="noopener"{{ end }}>{{ range .Content }}{{ Render . }}{{ end }}</a>{{ end }}
+`
+
+type Abstract struct {
+	Content []Renderable
+}
+
+var _ CompositeRenderable = (*Abstract)(nil)
+
+func (a *Abstract) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "Abstract", a)
+	return template.HTML(buf.String()), err
+}
+
+func (a *Abstract) Append(child Renderable) {
+	a.Content = append(a.Content, child)
+}
+
+func (a *Abstract) Children() []Renderable {
+	return a.Content
+}
+
+const HtmlAbstract = `
+{{ define "Abstract" }}
+<div class="abstract">
+	{{ range .Content }}
+		{{ Render . }}
+	{{ end }}
+</div>
 {{ end }}
 `
 
+type (
+	Image struct {
+		Src string
+		Alt string
+		Width, Height int // in pixels, prevents layout shift while loading
+		Variants []ImageVariant // downscaled versions, including the original
+	}
+	ImageVariant struct {
+		URL string
+		Width int
+	}
+)
+
+var _ Renderable = (*Image)(nil)
+
+func (i *Image) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "Image", i)
+	return template.HTML(buf.String()), err
+}
+
+func (i *Image) SrcSet() string {
+	var set []string
+	for _, v := range i.Variants {
+		set = append(set, fmt.Sprintf("%s %dw", v.URL, v.Width))
+	}
+	return strings.Join(set, ", ")
+}
+
+const HtmlImage = `
+{{ define "Image" }}<img src="{{.Src}}" alt="{{.Alt}}" width="{{.Width}}" height="{{.Height}}"{{ if .Variants }} srcset="{{.SrcSet}}" sizes="(max-width: 60ch) 100vw, 60ch"{{ end }} loading="lazy" decoding="async" />{{ end }}
+`
+
+type (
+	Figure struct {
+		ID string
+		Number int
+		Images []*Image
+		Caption *Caption
+	}
+	Caption struct {
+		Content []Renderable
+	}
+)
+
+var (
+	_ CompositeRenderable = (*Figure)(nil)
+	_ CompositeRenderable = (*Caption)(nil)
+)
+
+func NewFigure(id string, number int) *Figure {
+	return &Figure{
+		ID: id,
+		Number: number,
+	}
+}
+
+func (f *Figure) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "Figure", f)
+	return template.HTML(buf.String()), err
+}
+
+// Append only accepts images, the caption is set directly.
+func (f *Figure) Append(child Renderable) {
+	img, ok := child.(*Image)
+	Assert(ok, "figure can only contain images")
+	f.Images = append(f.Images, img)
+}
+
+func (f *Figure) Children() (children []Renderable) {
+	for _, img := range f.Images {
+		children = append(children, img)
+	}
+	if f.Caption != nil {
+		children = append(children, f.Caption)
+	}
+	return children
+}
+
+func (c *Caption) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "Caption", c)
+	return template.HTML(buf.String()), err
+}
+
+func (c *Caption) Append(child Renderable) {
+	c.Content = append(c.Content, child)
+}
+
+func (c *Caption) Children() []Renderable {
+	return c.Content
+}
+
+const HtmlFigure = `
+{{ define "Figure" }}
+<figure id="{{.ID}}">
+	{{ range .Images }}
+		{{ Render . }}
+	{{ end }}
+	<figcaption>
+		<a href="#{{.ID}}" class="figure-number">Figure {{.Number}}</a>{{ if .Caption }}: {{ Render .Caption }}{{ end }}
+	</figcaption>
+</figure>
+{{ end }}
+{{ define "Caption" }}{{ range .Content }}{{ Render . }}{{ end }}{{ end }}
+`
+
+type (
+	List struct {
+		Ordered bool
+		Start int // Ordered only
+		Items []*ListItem
+	}
+	ListItem struct {
+		Content []Renderable
+	}
+)
+
+var (
+	_ CompositeRenderable = (*List)(nil)
+	_ CompositeRenderable = (*ListItem)(nil)
+)
+
+func (l *List) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "List", l)
+	return template.HTML(buf.String()), err
+}
+
+// Append only accepts list items.
+func (l *List) Append(child Renderable) {
+	item, ok := child.(*ListItem)
+	Assert(ok, "list can only contain items")
+	l.Items = append(l.Items, item)
+}
+
+func (l *List) Children() (children []Renderable) {
+	for _, item := range l.Items {
+		children = append(children, item)
+	}
+	return children
+}
+
+func (i *ListItem) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "ListItem", i)
+	return template.HTML(buf.String()), err
+}
+
+func (i *ListItem) Append(child Renderable) {
+	i.Content = append(i.Content, child)
+}
+
+func (i *ListItem) Children() []Renderable {
+	return i.Content
+}
+
+const HtmlList = `
+{{ define "List" }}
+{{ if .Ordered }}<ol{{ if ne .Start 1 }} start="{{.Start}}"{{ end }}>{{ else }}<ul>{{ end }}
+	{{ range .Items }}
+		{{ Render . }}
+	{{ end }}
+{{ if .Ordered }}</ol>{{ else }}</ul>{{ end }}
+{{ end }}
+{{ define "ListItem" }}<li>{{ range .Content }}{{ Render . }}{{ end }}</li>{{ end }}
+`
+
+type (
+	DefList struct {
+		Entries []*DefEntry
+	}
+	DefEntry struct {
+		Term bool // otherwise a definition of the preceding term
+		Content []Renderable
+	}
+)
+
+var (
+	_ CompositeRenderable = (*DefList)(nil)
+	_ CompositeRenderable = (*DefEntry)(nil)
+)
+
+func (l *DefList) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "DefList", l)
+	return template.HTML(buf.String()), err
+}
+
+// Append only accepts terms and definitions.
+func (l *DefList) Append(child Renderable) {
+	entry, ok := child.(*DefEntry)
+	Assert(ok, "definition list can only contain terms and definitions")
+	l.Entries = append(l.Entries, entry)
+}
+
+func (l *DefList) Children() (children []Renderable) {
+	for _, entry := range l.Entries {
+		children = append(children, entry)
+	}
+	return children
+}
+
+func (e *DefEntry) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "DefEntry", e)
+	return template.HTML(buf.String()), err
+}
+
+func (e *DefEntry) Append(child Renderable) {
+	e.Content = append(e.Content, child)
+}
+
+func (e *DefEntry) Children() []Renderable {
+	return e.Content
+}
+
+const HtmlDefList = `
+{{ define "DefList" }}
+<dl>
+	{{ range .Entries }}
+		{{ Render . }}
+	{{ end }}
+</dl>
+{{ end }}
+{{ define "DefEntry" }}{{ if .Term }}<dt>{{ else }}<dd>{{ end }}{{ range .Content }}{{ Render . }}{{ end }}{{ if .Term }}</dt>{{ else }}</dd>{{ end }}{{ end }}
+`
+
+type (
+	Table struct {
+		ID string
+		Number int
+		Caption *Caption
+		Align []string // of each column
+		Head, Body []*TableRow
+	}
+	TableRow struct {
+		Header bool
+		Cells []*TableCell
+	}
+	TableCell struct {
+		Header bool
+		Span int // number of columns
+		Align string
+		Content []Renderable
+	}
+)
+
+var (
+	_ CompositeRenderable = (*Table)(nil)
+	_ CompositeRenderable = (*TableRow)(nil)
+	_ CompositeRenderable = (*TableCell)(nil)
+)
+
+func NewTable(id string, number int) *Table {
+	return &Table{
+		ID: id,
+		Number: number,
+	}
+}
+
+func (t *Table) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "Table", t)
+	return template.HTML(buf.String()), err
+}
+
+// Append only accepts rows, the caption is set directly.
+func (t *Table) Append(child Renderable) {
+	row, ok := child.(*TableRow)
+	Assert(ok, "table can only contain rows")
+	if row.Header {
+		t.Head = append(t.Head, row)
+	} else {
+		t.Body = append(t.Body, row)
+	}
+}
+
+func (t *Table) Children() (children []Renderable) {
+	if t.Caption != nil {
+		children = append(children, t.Caption)
+	}
+	for _, row := range append(t.Head, t.Body...) {
+		children = append(children, row)
+	}
+	return children
+}
+
+func (r *TableRow) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "TableRow", r)
+	return template.HTML(buf.String()), err
+}
+
+// Append only accepts cells.
+func (r *TableRow) Append(child Renderable) {
+	cell, ok := child.(*TableCell)
+	Assert(ok, "table row can only contain cells")
+	r.Cells = append(r.Cells, cell)
+}
+
+func (r *TableRow) Children() (children []Renderable) {
+	for _, cell := range r.Cells {
+		children = append(children, cell)
+	}
+	return children
+}
+
+func (c *TableCell) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "TableCell", c)
+	return template.HTML(buf.String()), err
+}
+
+func (c *TableCell) Append(child Renderable) {
+	c.Content = append(c.Content, child)
+}
+
+func (c *TableCell) Children() []Renderable {
+	return c.Content
+}
+
+const HtmlTable = `
+{{ define "Table" }}
+<table id="{{.ID}}">
+	<caption>
+		<a href="#{{.ID}}" class="table-number">Table {{.Number}}</a>{{ if .Caption }}: {{ Render .Caption }}{{ end }}
+	</caption>
+	{{ if .Head }}
+	<thead>
+		{{ range .Head }}
+		{{ Render . }}
+		{{ end }}
+	</thead>
+	{{ end }}
+	<tbody>
+		{{ range .Body }}
+		{{ Render . }}
+		{{ end }}
+	</tbody>
+</table>
+{{ end }}
+{{ define "TableRow" }}<tr>{{ range .Cells }}{{ Render . }}{{ end }}</tr>{{ end }}
+{{ define "TableCell" }}{{ if .Header }}<th scope="col"{{ else }}<td{{ end }}{{ if gt .Span 1 }} colspan="{{.Span}}"{{ end }}{{ if .Align }} class="align-{{.Align}}"{{ end }}>{{ range .Content }}{{ Render . }}{{ end }}{{ if .Header }}</th>{{ else }}</td>{{ end }}{{ end }}
+`
+
 type Aside struct {
 	Content []Renderable
 }
@@ -441,6 +1005,10 @@ func (a *Aside) Append(child Renderable) {
 	a.Content = append(a.Content, child)
 }
 
+func (a *Aside) Children() []Renderable {
+	return a.Content
+}
+
 const HtmlAside = `
 {{ define "Aside" }}
 <aside>
@@ -468,9 +1036,9 @@ type Sidenote struct {
 
 var _ CompositeRenderable = (*Sidenote)(nil)
 
-func NewSidenote(short string) *Sidenote {
+func NewSidenote(id, short string) *Sidenote {
 	return &Sidenote{
-		ID: GenerateID("sn"),
+		ID: id,
 		ShortText: short,
 	}
 }
@@ -485,6 +1053,10 @@ func (s *Sidenote) Append(child Renderable) {
 	s.Expanded = append(s.Expanded, child)
 }
 
+func (s *Sidenote) Children() []Renderable {
+	return s.Expanded
+}
+
 func (s *Sidenote) ExpandedTextOnly() string {
 	text := ""
 	for _, r := range s.Expanded {
@@ -518,25 +1090,92 @@ const HtmlSidenote = `
 </span>{{ end }}
 `
 
-type CodeLine string
+type (
+	Footnote struct {
+		ID, RefID string
+		Number int
+		Content []Renderable
+	}
+	// FootnoteRef marks where the footnote is referenced in the text.
+	FootnoteRef struct {
+		*Footnote
+	}
+)
 
-type CodeBlock struct {
-	Lines []CodeLine
+var (
+	_ CompositeRenderable = (*Footnote)(nil)
+	_ Renderable = (*FootnoteRef)(nil)
+)
+
+func NewFootnote(id, refID string, number int) *Footnote {
+	return &Footnote{
+		ID: id,
+		RefID: refID,
+		Number: number,
+	}
+}
+
+func (f *Footnote) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "Footnote", f)
+	return template.HTML(buf.String()), err
 }
 
-var _ Renderable = (*CodeBlock)(nil)
+func (f *Footnote) Append(child Renderable) {
+	f.Content = append(f.Content, child)
+}
 
-func (c CodeBlock) Render() (template.HTML, error) {
+func (f *Footnote) Children() []Renderable {
+	return f.Content
+}
+
+func (r *FootnoteRef) Render() (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	err := pages.Execute(buf, "FootnoteRef", r)
+	return template.HTML(buf.String()), err
+}
+
+const HtmlFootnote = `
+{{ define "Footnote" }}<li id="{{.ID}}">{{ range .Content }}{{ Render . }}{{ end }} <a href="#{{.RefID}}" class="footnote-back" aria-label="back to text">↩</a></li>{{ end }}
+{{ define "FootnoteRef" }}<sup id="{{.RefID}}" class="footnote-ref"><a href="#{{.ID}}">{{.Number}}</a></sup>{{ end }}
+`
+
+type (
+	CodeBlock struct {
+		Lang string
+		File string
+		Lines []CodeLine
+		Source string // without highlighting, for copying
+	}
+	CodeLine struct {
+		Number int
+		Highlighted bool
+		HTML template.HTML // syntax highlighted
+	}
+)
+
+var _ TextRenderable = (*CodeBlock)(nil)
+
+func (c *CodeBlock) Render() (template.HTML, error) {
 	buf := &bytes.Buffer{}
 	err := pages.Execute(buf, "CodeBlock", c)
 	return template.HTML(buf.String()), err
 }
 
+func (c *CodeBlock) Text() string {
+	return c.Source
+}
+
+// The line numbers are generated by CSS, so that they are not copied along
+// with the code.
 const HtmlCodeBlock = `
 {{ define "CodeBlock" }}
-<pre><code>
-{{ range .Lines }} <span class="line-number">{{ . }}</span> {{ end }}
-</pre></code>
+<figure class="code">
+	{{ if .File }}<figcaption class="code-file">{{.File}}</figcaption>{{ end }}
+	<button class="code-copy" type="button" onclick="navigator.clipboard.writeText(this.nextElementSibling.dataset.source)">copy</button>
+	<pre data-source="{{.Source}}"><code{{ if .Lang }} class="language-{{.Lang}}"{{ end }}>{{ range .Lines }}<span class="line{{ if .Highlighted }} highlighted{{ end }}" data-line="{{.Number}}">{{.HTML}}</span>
+{{ end }}</code></pre>
+</figure>
 {{ end }}
 `
 
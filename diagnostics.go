@@ -0,0 +1,84 @@
+package be
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"be/tok"
+)
+
+type (
+	Severity int
+	Diagnostic struct {
+		Severity Severity
+		Err error // usually an EvalError
+	}
+	// Diagnostics collects the warnings and errors of an evaluation.
+	// Set on Scopes, an error in a form is collected, and the evaluation
+	// continues with the next form.
+	Diagnostics struct {
+		List []Diagnostic
+		Strict bool // reports warnings as errors
+	}
+)
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Severity, d.Err)
+}
+
+func (d Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+func (d *Diagnostics) add(severity Severity, err error) {
+	if d.Strict {
+		severity = SeverityError
+	}
+	d.List = append(d.List, Diagnostic{severity, err})
+}
+
+// Count returns the number of diagnostics of the severity.
+func (d *Diagnostics) Count(severity Severity) (n int) {
+	for _, diag := range d.List {
+		if diag.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// Warn reports a problem that does not stop the evaluation.
+// Without Diagnostics, it is logged.
+func (s *Scopes) Warn(pos tok.Position, format string, a ...any) {
+	err := s.evalError(fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, a...)))
+	if s.Diagnostics == nil {
+		log.Printf("warning: %v", err)
+		return
+	}
+	s.Diagnostics.add(SeverityWarning, err)
+}
+
+// Recoverable collects err, so that the evaluation continues, and returns
+// nil. Without Diagnostics, err is returned as is, and so is a
+// MacroDepthError: continuing after it would expand the macro again (and
+// again, for a macro expanding to itself more than once).
+func (s *Scopes) Recoverable(err error) error {
+	if err == nil || s.Diagnostics == nil || errors.As(err, new(MacroDepthError)) {
+		return err
+	}
+	s.Diagnostics.add(SeverityError, s.evalError(err))
+	return nil
+}
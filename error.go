@@ -0,0 +1,137 @@
+package be
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"be/tok"
+)
+
+type (
+	// EvalError is an error evaluating a document, together with the forms
+	// that were being evaluated when it occurred.
+	EvalError struct {
+		Err error
+		Forms []Frame // outermost first
+	}
+	// Frame is a form being evaluated.
+	Frame struct {
+		Name string
+		// Text the form starts with, if it identifies the form (like the
+		// heading of a section).
+		Text string
+		// Index among the forms of the same name in the enclosing form,
+		// counted from 1.
+		Index int
+		Pos, End tok.Position // of the form's name
+		counts map[string]int // of the forms evaluated within
+	}
+)
+
+func (e EvalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e EvalError) Unwrap() error {
+	return e.Err
+}
+
+// Trace returns the (non-internal) forms leading to the error, like:
+//
+//	body #1 > section "The Bad Parts" > paragraph #3 > sidenote
+//
+// The index of the innermost form is left out, the error points to it.
+// Consecutive forms of the same name (a recursive macro) are shown once,
+// with how often they repeat: body #1 > r ×100.
+// Errors in top-level forms have no trace.
+func (e EvalError) Trace() string {
+	type run struct {
+		frame Frame
+		count int
+	}
+	var runs []run
+	for _, frame := range e.Forms {
+		if sig, ok := signatures[frame.Name]; ok && sig.Internal {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].frame.Name == frame.Name && runs[n-1].frame.Text == frame.Text {
+			runs[n-1].count++
+			continue
+		}
+		runs = append(runs, run{frame, 1})
+	}
+	if len(runs) == 0 || (len(runs) == 1 && runs[0].count == 1) {
+		return ""
+	}
+	var forms []string
+	for i, run := range runs {
+		form := run.frame.Name
+		if run.frame.Text != "" {
+			form = fmt.Sprintf("%s %q", run.frame.Name, run.frame.Text)
+		}
+		switch {
+		case run.count > 1:
+			form += fmt.Sprintf(" ×%d", run.count)
+		case run.frame.Text == "" && i < len(runs)-1:
+			form += fmt.Sprintf(" #%d", run.frame.Index)
+		}
+		forms = append(forms, form)
+	}
+	return strings.Join(forms, " > ")
+}
+
+// Innermost returns the form in which the error occurred.
+func (e EvalError) Innermost() Frame {
+	return e.Forms[len(e.Forms)-1]
+}
+
+func (s *Scopes) pushFrame(atom *Node) {
+	frame := Frame{
+		Name: string(atom.Atom),
+		Pos: atom.Pos,
+		End: atom.End,
+		counts: map[string]int{},
+	}
+	if n := len(s.frames); n > 0 {
+		s.frames[n-1].counts[frame.Name]++
+		frame.Index = s.frames[n-1].counts[frame.Name]
+	}
+	s.frames = append(s.frames, frame)
+}
+
+func (s *Scopes) popFrame() {
+	s.frames = s.frames[:len(s.frames)-1]
+}
+
+// maxFrameText is the number of runes of text shown for a form in traces.
+const maxFrameText = 32
+
+// labelFrame sets the text of the current form, if its first argument is
+// text identifying it.
+func (s *Scopes) labelFrame(args *Args) {
+	frame := &s.frames[len(s.frames)-1]
+	sig, ok := signatures[frame.Name]
+	if !ok || len(sig.Params) == 0 || sig.Params[0].Variadic || sig.Params[0].Type != TypeText {
+		return
+	}
+	arg := args.Peek()
+	if arg == nil || arg.Type != TypeText {
+		return
+	}
+	text, _, _ := strings.Cut(strings.TrimSpace(string(arg.Text)), "\n")
+	if runes := []rune(text); len(runes) > maxFrameText {
+		text = string(runes[:maxFrameText-1]) + "…"
+	}
+	frame.Text = text
+}
+
+// evalError returns err as EvalError with the forms being evaluated, unless
+// it already is one (from a form nested deeper).
+func (s *Scopes) evalError(err error) error {
+	if errors.As(err, new(EvalError)) {
+		return err
+	}
+	return EvalError{err, slices.Clone(s.frames)}
+}
@@ -0,0 +1,80 @@
+package be
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"be/lex"
+	"be/tok"
+)
+
+// eval evaluates the document src, returning the first error.
+func eval(t *testing.T, src string) error {
+	t.Helper()
+	return evalWith(t, src, nil)
+}
+
+// evalWith evaluates the document src, collecting the errors the evaluation
+// recovers from in diagnostics, if set.
+func evalWith(t *testing.T, src string, diagnostics *Diagnostics) error {
+	t.Helper()
+	tokens, err := tok.NewSourceTokenizer("test.be", []rune(src), nil).Tokenize()
+	if err != nil {
+		t.Fatalf("tokenize: %v", err)
+	}
+	root, err := lex.Lex(tokens)
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+	blog := NewBlog(DefaultSite)
+	scopes := InitScopes(blog)
+	scopes.Diagnostics = diagnostics
+	return blog.Eval(scopes, root.First)
+}
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		src, trace string
+	}{
+		{`{em}`, ``},
+		{`{body {paragraph x} {paragraph {em}}}`, `body #1 > paragraph #2 > em`},
+		{`{body {section Heading {paragraph {em}}}}`, `body #1 > section "Heading" > paragraph #1 > em`},
+		{`{define r {r}}{body {r}}`, fmt.Sprintf(`body #1 > r ×%d`, MaxMacroDepth+1)},
+		{`{define r {r}}{r}`, fmt.Sprintf(`r ×%d`, MaxMacroDepth+1)},
+		{`{body {list {item {list {item {em}}}}}}`, `body #1 > list #1 > item #1 > list #1 > item #1 > em`},
+	}
+	for _, test := range tests {
+		var evalErr EvalError
+		if err := eval(t, test.src); !errors.As(err, &evalErr) {
+			t.Errorf("%s: want: EvalError, got: %v", test.src, err)
+			continue
+		}
+		if trace := evalErr.Trace(); trace != test.trace {
+			t.Errorf("%s: want: %q, got: %q", test.src, test.trace, trace)
+		}
+	}
+}
+
+// The evaluation must not continue after a too deep expansion, even if it
+// recovers from errors: every level would expand the macro again.
+func TestMacroDepthNotRecovered(t *testing.T) {
+	for _, src := range []string{
+		`{define r {r}}{body {r}}`,
+		`{define r {r}{r}}{body {r}}`,
+	} {
+		done := make(chan error, 1)
+		go func() {
+			done <- evalWith(t, src, &Diagnostics{})
+		}()
+		select {
+		case err := <-done:
+			if !errors.As(err, new(MacroDepthError)) {
+				t.Errorf("%s: want: MacroDepthError, got: %v", src, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: evaluation does not end", src)
+		}
+	}
+}
@@ -2,11 +2,16 @@ package be
 
 import (
 	"fmt"
-	"log"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"be/lex"
+	"be/tok"
 	. "be/internal/debug"
 )
 
@@ -29,14 +34,29 @@ type (
 	}
 	Scope struct {
 		funs FunMap
+		defs map[string]tok.Position // where the funs were defined
 		Context *Context
 	}
 	Scopes struct {
 		scopes []Scope
+		depth int // of macro expansions
+		includes []tok.Position // sites of the includes being evaluated
+		frames []Frame // forms being evaluated
+		// Sources keeps the included files, so that they can be quoted in
+		// diagnostics.
+		Sources *tok.Sources
+		// Diagnostics collects warnings and errors, if set, so that the
+		// evaluation continues after an error in a form.
+		Diagnostics *Diagnostics
+		// DryRun evaluates a document without side effects, such as
+		// generating image variants, to check it while it is edited.
+		DryRun bool
 	}
 	Args struct {
-		finished bool
+		fun *Node // atom naming the form
 		next *Node
+		sig *Signature // the arguments were checked against, if any
+		keywords []*keyword
 	}
 	beFun func(blog *Blog, scopes *Scopes, args *Args) error
 )
@@ -44,6 +64,7 @@ type (
 func NewScope(parent CompositeRenderable) Scope {
 	return Scope{
 		funs: FunMap{},
+		defs: map[string]tok.Position{},
 		Context: &Context{
 			Parent: parent,
 		},
@@ -59,6 +80,7 @@ func InitScopes(blog *Blog) *Scopes {
 					Parent: blog,
 				},
 			},
+			NewScope(blog), // document scope, so that rootFuns is never modified
 		},
 	}
 }
@@ -75,8 +97,29 @@ func (s *Scopes) Top() Scope {
 	return s.scopes[len(s.scopes)-1]
 }
 
+// RegisterFun registers fun in the scope of the current form, it is only
+// visible to the form's arguments.
+// The arguments are checked against the signature of the form name.
 func (s *Scopes) RegisterFun(name string, fun beFun) {
-	s.Top().funs[name] = fun
+	s.Top().funs[name] = checked(name, fun)
+}
+
+// Define registers fun, defined at pos, in the scope enclosing the current
+// form, it is visible to the forms following the current one.
+// Defining it again from the same position (a file imported twice) keeps
+// the first definition.
+func (s *Scopes) Define(name string, fun beFun, pos tok.Position) error {
+	Assert(len(s.scopes) > 2, "define must be called from within a form")
+	scope := s.scopes[len(s.scopes)-2]
+	if _, ok := scope.funs[name]; ok {
+		if prev := scope.defs[name]; !samePosition(prev, pos) {
+			return fmt.Errorf("already defined in this scope: %s, first defined at: %s", name, prev)
+		}
+		return nil
+	}
+	scope.funs[name] = fun
+	scope.defs[name] = pos
+	return nil
 }
 
 func (s *Scopes) Resolve(name string) (beFun, error) {
@@ -92,303 +135,379 @@ func (s *Scopes) Parent() CompositeRenderable {
 	return s.Top().Context.Parent
 }
 
-func NewArgs(node *Node) *Args {
+// NewArgs returns the arguments following the atom fun.
+func NewArgs(fun *Node) *Args {
 	return &Args{
-		next: node,
+		fun: fun,
+		next: fun.Next,
 	}
 }
 
-func (a *Args) Next(name string, type_ lex.FormType) (*Node, error) {
-	Assert(!a.finished, "all mandatory arguments must appear before optional ones")
-	if a.next == nil {
-		return nil, fmt.Errorf("missing argument: %s", name)
-	}
+// Next returns the next argument, or nil if there is none.
+// The arguments are checked against the signature of the form before it is
+// evaluated, so each argument has the type its parameter declares.
+func (a *Args) Next() *Node {
 	arg := a.next
-	a.next = a.next.Next
-	if (arg.Type & type_) == 0 {
-		return arg, fmt.Errorf("argument of incorrect type, want: %+v, got: %+v", type_, arg)
+	if arg != nil {
+		a.next = arg.Next
 	}
-	return arg, nil
+	return arg
 }
 
-func (a *Args) Optional(name string, type_ lex.FormType) (*Node, error) {
-	a.finished = true
-	if a.next == nil {
-		return nil, nil
-	}
-	arg := a.next
-	a.next = a.next.Next
-	if (arg.Type & type_) == 0 {
-		return arg, fmt.Errorf("argument of incorrect type, want: %+v, got: %+v", type_, arg)
-	}
-	return arg, nil
+// Peek returns the next argument without consuming it, or nil.
+func (a *Args) Peek() *Node {
+	return a.next
 }
 
-func (a *Args) IsFinished() bool {
-	return a.next == nil
+// formName returns the name of the form node, or "" if it is not a form.
+func formName(node *Node) string {
+	if node.Type != TypeForm || node.Form.First == nil {
+		return ""
+	}
+	return string(node.Form.First.Atom)
 }
 
-func (a *Args) Finished() error {
-	if !a.IsFinished() {
-		return fmt.Errorf("superfluous arguments: %+v", a.next)
+// applyAll applies the remaining arguments to parent.
+func (blog *Blog) applyAll(parent CompositeRenderable, scopes *Scopes, args *Args) error {
+	for content := args.Next(); content != nil; content = args.Next() {
+		if err := blog.Apply(parent, scopes, content); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 var rootFuns = FunMap {
 	"root": func(blog *Blog, scopes *Scopes, args *Args) error {
-		// @todo: read defaults from config file?
-		blog.BlogName = "save-lisp-and-die"
-		blog.Author = Author{}
-		blog.Author.Name = "cvl"
-
-		for !args.IsFinished() {
-			content, err := args.Optional("root content", TypeForm)
-			if err != nil {
-				return fmt.Errorf("root: %w", err)
-			}
+		for content := args.Next(); content != nil; content = args.Next() {
 			if err := blog.Apply(blog, scopes, content.Form.First); err != nil {
 				return err
 			}
 		}
-		return args.Finished()
+		return nil
 	},
 	"eof": func(blog *Blog, scopes *Scopes, args *Args) error {
-		// @todo: fill in blog.Meta?
-		blog.Meta = Meta{
-			Language: "en",
-			//CanonicalURL string
-			//Description string
-			Published: time.Now(),
-			//Revisions []time.Time
-			//Topic string
-			//EstReadingTime ReadingTime
-		}
-		return args.Finished()
+		if blog.Meta.IsDraft() {
+			scopes.Warn(args.fun.Pos, "published: missing publication date, the post is a draft")
+		}
+		for _, rev := range blog.Meta.Revisions {
+			if !blog.Meta.IsDraft() && rev.Date.Before(blog.Meta.Published) {
+				form := rev.forms[len(rev.forms)-1]
+				err := fmt.Errorf("%s: revised: revision %s (%s) predates publication %s", form.Pos, rev.Date.Format(DateFormat), rev.Note, blog.Meta.Published.Format(DateFormat))
+				if err := scopes.Recoverable(EvalError{err, rev.forms}); err != nil {
+					return err
+				}
+			}
+		}
+		wordsPerMinute := blog.Site.WordsPerMinute
+		if wordsPerMinute <= 0 {
+			wordsPerMinute = DefaultSite.WordsPerMinute
+		}
+		blog.Meta.EstReadingTime = EstimateReadingTime(blog, wordsPerMinute)
+		if blog.Meta.CanonicalURL == "" && blog.Site.BaseURL != "" {
+			blog.Meta.CanonicalURL = blog.Site.BaseURL + "/" + filepath.Base(blog.Site.OutputPath(args.fun.Pos.FileName()))
+		}
+		return nil
 	},
 	"html-comment": func(blog *Blog, scopes *Scopes, args *Args) error {
-		content, err := args.Optional("html-comment text", TypeText)
-		if err != nil {
-			return fmt.Errorf("html-comment: %w", err)
-		}
-		comment := Comment(content.Text)
-		scopes.Parent().Append(comment)
-		return args.Finished()
+		content := args.Next()
+		scopes.Parent().Append(Comment(content.Text))
+		return nil
 	},
 	"comment": func(blog *Blog, scopes *Scopes, args *Args) error {
-		for !args.IsFinished() {
-			content, err := args.Optional("comment content (will be ignored)", TypeAny)
-			if err != nil {
-				return fmt.Errorf("comment: %w", err)
-			}
-			_ = content
-		}
-		return args.Finished()
+		return nil // content is ignored
 	},
 	"title": func(blog *Blog, scopes *Scopes, args *Args) error {
-		title, err := args.Next("title", TypeText)
-		if err != nil {
-			return err
-		}
-		blog.Title = string(title.Text)
-		altTitle, err := args.Optional("alternative title", TypeText)
-		if err != nil {
-			return err
-		}
-		if altTitle != nil {
+		blog.Title = string(args.Next().Text)
+		if altTitle := args.Next(); altTitle != nil {
 			blog.AltTitle = string(altTitle.Text)
 		}
-		return args.Finished()
+		return nil
 	},
 	"author": func(blog *Blog, scopes *Scopes, args *Args) error {
 		blog.Author = Author{} // ensure author is initialized and zeroed
 		scopes.RegisterFun("name", func(blog *Blog, scopes *Scopes, args *Args) error {
-			name, err := args.Next("author name", TypeText)
-			if err != nil {
-				return fmt.Errorf("author-name: %w", err)
-			}
-			blog.Author.Name = string(name.Text)
-			return args.Finished()
+			blog.Author.Name = string(args.Next().Text)
+			return nil
 		})
 		scopes.RegisterFun("email", func(blog *Blog, scopes *Scopes, args *Args) error {
-			email, err := args.Next("author email", TypeText)
-			if err != nil {
-				return fmt.Errorf("author-email: %w", err)
-			}
-			blog.Author.EMail = string(email.Text)
-			return args.Finished()
+			blog.Author.EMail = string(args.Next().Text)
+			return nil
 		})
-		for _ = range len(scopes.Top().funs) {
-			nextArgs, err := args.Optional("author args", TypeForm)
-			if err != nil {
-				return fmt.Errorf("author: %w", err)
-			}
-			err = blog.Apply(scopes.Parent(), scopes, nextArgs.Form.First)
-			if err != nil {
+		for content := args.Next(); content != nil; content = args.Next() {
+			if err := blog.Apply(scopes.Parent(), scopes, content.Form.First); err != nil {
 				return err
 			}
 		}
-		return args.Finished()
+		return nil
 	},
 	"tags": func(blog *Blog, scopes *Scopes, args *Args) error {
 		if len(blog.Tags) > 0 {
-			log.Printf("tags: already set, overwriting")
+			scopes.Warn(args.fun.Pos, "tags: already set, overwriting")
 		}
 		tags := Tags{}
-		for !args.IsFinished() {
-			tagList, err := args.Optional("space separated tag list", TypeText)
-			if err != nil {
-				return fmt.Errorf("tags: %w", err)
-			}
-			for _, tagStr := range strings.Split(string(tagList.Text), " ") {
+		for tagList := args.Next(); tagList != nil; tagList = args.Next() {
+			for _, tagStr := range strings.Fields(string(tagList.Text)) {
 				tags = append(tags, Tag(tagStr))
 			}
 		}
 		blog.Tags = tags
-		return args.Finished()
+		return nil
 	},
 	"body": func(blog *Blog, scopes *Scopes, args *Args) error {
-		for !args.IsFinished() {
-			content, err := args.Optional("body content", TypeAny)
-			if err != nil {
-				return fmt.Errorf("body: %w", err)
-			}
-			err = blog.Apply(blog, scopes, content)
-			if err != nil {
-				return fmt.Errorf("body: %w", err)
-			}
-		}
-		return args.Finished()
+		return blog.applyAll(blog, scopes, args)
 	},
 	"paragraph": func(blog *Blog, scopes *Scopes, args *Args) error {
 		pg := &Paragraph{}
 		scopes.Parent().Append(pg)
-		for !args.IsFinished() {
-			content, err := args.Optional("paragraph content", TypeAny)
-			if err != nil {
-				return fmt.Errorf("paragraph: %w", err)
-			}
-			err = blog.Apply(pg, scopes, content)
-			if err != nil {
-				return fmt.Errorf("paragraph: %w", err)
-			}
-		}
-		return args.Finished()
+		return blog.applyAll(pg, scopes, args)
 	},
 	"section": func(blog *Blog, scopes *Scopes, args *Args) error {
 		scopes.RegisterFun("subsection", func(blog *Blog, scopes *Scopes, args *Args) error {
-			heading, err := args.Next("subsection heading", TypeText)
-			if err != nil {
-				return fmt.Errorf("subsection: %w", err)
-			}
-			subsection := NewSubsection(string(heading.Text))
+			heading := args.Next()
+			subsection := NewSubsection(blog.anchor(blog.GenerateID(string(heading.Text)), heading), string(heading.Text))
 			scopes.Parent().Append(subsection)
-			for !args.IsFinished() {
-				content, err := args.Optional("subsection content", TypeAny)
-				if err != nil {
-					return fmt.Errorf("subsection: %w", err)
-				}
-				err = blog.Apply(subsection, scopes, content)
-				if err != nil {
-					return fmt.Errorf("subsection: %w", err)
-				}
-			}
-			return args.Finished()
+			return blog.applyAll(subsection, scopes, args)
 		})
-		heading, err := args.Next("section heading", TypeText)
-		if err != nil {
-			return fmt.Errorf("section: %w", err)
-		}
-		section := NewSection(string(heading.Text))
+		heading := args.Next()
+		section := NewSection(blog.anchor(blog.GenerateID(string(heading.Text)), heading), string(heading.Text))
 		scopes.Parent().Append(section)
-		for !args.IsFinished() {
-			content, err := args.Optional("section content", TypeAny)
-			if err != nil {
-				return fmt.Errorf("section: %w", err)
-			}
-			err = blog.Apply(section, scopes, content)
-			if err != nil {
-				return fmt.Errorf("section: %w", err)
-			}
-		}
-		return args.Finished()
+		return blog.applyAll(section, scopes, args)
 	},
 	"abstract": func(blog *Blog, scopes *Scopes, args *Args) error {
-		// @fixme: implement correctly
-		for !args.IsFinished() {
-			content, err := args.Optional("abstract content", TypeAny)
-			if err != nil {
-				return fmt.Errorf("abstract: %w", err)
-			}
-			_ = content
+		abstract := &Abstract{}
+		if err := blog.applyAll(abstract, scopes, args); err != nil {
+			return err
 		}
-		return args.Finished()
+		if len(abstract.Content) > 0 {
+			blog.Abstract = abstract
+		}
+		return nil
 	},
 	"enquote": func(blog *Blog, scopes *Scopes, args *Args) error {
-		text, err := args.Next("enquote text", TypeText)
-		if err != nil {
-			return fmt.Errorf("enquote: %w", err)
-		}
-		scopes.Parent().Append(Enquote(text.Text))
-		return args.Finished()
+		scopes.Parent().Append(Enquote(args.Next().Text))
+		return nil
 	},
 	"sidenote": func(blog *Blog, scopes *Scopes, args *Args) error {
-		short, err := args.Next("sidenote short text", TypeText)
-		if err != nil {
-			return fmt.Errorf("sidenote: %w", err)
+		// the short text is usually separated by \\, keeping the space before it
+		short := strings.TrimSpace(string(args.Next().Text))
+		var sidenote CompositeRenderable
+		if blog.Site.Sidenotes == SidenotesAsFootnotes {
+			scopes.Parent().Append(Text(short))
+			sidenote = blog.newFootnote(scopes.Parent(), args.fun)
+		} else {
+			sidenote = NewSidenote(blog.GenerateID("sn"), short)
+			scopes.Parent().Append(sidenote)
 		}
-		sidenote := NewSidenote(string(short.Text))
-		scopes.Parent().Append(sidenote)
-		for !args.IsFinished() {
-			content, err := args.Optional("sidenote content", TypeAny)
-			if err != nil {
-				return fmt.Errorf("sidenote: %w", err)
-			}
-			err = blog.Apply(sidenote, scopes, content)
+		return blog.applyAll(sidenote, scopes, args)
+	},
+	"mono": func(blog *Blog, scopes *Scopes, args *Args) error {
+		scopes.Parent().Append(Mono(args.Next().Text))
+		return nil
+	},
+	"code": codeFun,
+	"define": func(blog *Blog, scopes *Scopes, args *Args) error {
+		name := args.Next()
+		// the name may be followed by body text: {define name body...}
+		nameText, bodyText, _ := strings.Cut(strings.TrimLeftFunc(string(name.Text), tok.IsWhitespace), " ")
+		macro := &Macro{
+			Name: strings.TrimSpace(nameText),
+		}
+		if macro.Name == "" || strings.ContainsFunc(macro.Name, tok.IsWhitespace) {
+			return fmt.Errorf("%s: define: invalid macro name: %q", name.Pos, macro.Name)
+		}
+		if bodyText != "" {
+			macro.Body = append(macro.Body, &Node{
+				Type: TypeText,
+				Text: lex.Text(bodyText),
+				Pos: name.Pos,
+				End: name.End,
+			})
+		} else if params := args.Peek(); params != nil && formName(params) == "params" {
+			args.Next()
+			var err error
+			macro.Params, err = parseParams(params)
 			if err != nil {
-				return fmt.Errorf("sidenote: %w", err)
+				return err
 			}
 		}
-		return args.Finished()
+		for content := args.Next(); content != nil; content = args.Next() {
+			macro.Body = append(macro.Body, content)
+		}
+		if err := scopes.Define(macro.Name, macro.fun(scopes), name.Pos); err != nil {
+			return fmt.Errorf("%s: define: %w", name.Pos, err)
+		}
+		return nil
 	},
-	"mono": func(blog *Blog, scopes *Scopes, args *Args) error {
-		text, err := args.Next("monospace text", TypeText)
+	"link": func(blog *Blog, scopes *Scopes, args *Args) error {
+		target := args.Next()
+		// the url is the first word, followed by the link text
+		rawURL, text, _ := strings.Cut(strings.TrimLeftFunc(string(target.Text), tok.IsWhitespace), " ")
+		link, err := NewLink(blog.Site, rawURL)
 		if err != nil {
-			return fmt.Errorf("mono: %w", err)
+			return fmt.Errorf("%s: link: %w", target.Pos, err)
 		}
-		scopes.Parent().Append(Mono(text.Text))
-		return args.Finished()
+		scopes.Parent().Append(link)
+		if text = strings.TrimLeftFunc(text, tok.IsWhitespace); text != "" {
+			link.Append(Text(text))
+		}
+		if err := blog.applyAll(link, scopes, args); err != nil {
+			return err
+		}
+		if len(link.Content) == 0 {
+			link.Append(Text(linkText(rawURL)))
+		}
+		return nil
 	},
-	"code": func(blog *Blog, scopes *Scopes, args *Args) error {
-		text, err := args.Next("code text", TypeText)
+	"ref": func(blog *Blog, scopes *Scopes, args *Args) error {
+		target := args.Next()
+		rawURL := strings.TrimSpace(string(target.Text))
+		link, err := NewLink(blog.Site, rawURL)
 		if err != nil {
-			return fmt.Errorf("code: %w", err)
+			return fmt.Errorf("%s: ref: %w", target.Pos, err)
 		}
-		var code CodeBlock
-		for _, line := range strings.Split(string(text.Text), "\n") {
-			code.Lines = append(code.Lines, CodeLine(line))
+		link.Append(Text(linkText(rawURL)))
+		scopes.Parent().Append(link)
+		return nil
+	},
+	"list": listFun("list", false),
+	"enumerate": listFun("enumerate", true),
+	"deflist": deflistFun,
+	"footnote": footnoteFun,
+	"table": tableFun("table", false),
+	"table-csv": tableFun("table-csv", true),
+	"image": imageFun,
+	"figure": figureFun,
+	"published": func(blog *Blog, scopes *Scopes, args *Args) error {
+		published, err := parseDate("published", args.Next())
+		if err != nil {
+			return err
 		}
-		scopes.Parent().Append(code)
-		return args.Finished()
+		blog.Meta.Published = published
+		return nil
 	},
-	"em": func(blog *Blog, scopes *Scopes, args *Args) error {
-		text, err := args.Next("em text", TypeText)
+	"revised": func(blog *Blog, scopes *Scopes, args *Args) error {
+		text := args.Next()
+		dateText, note, _ := strings.Cut(strings.TrimSpace(string(text.Text)), " ")
+		date, err := parseDate("revised", &Node{Type: TypeText, Text: lex.Text(dateText), Pos: text.Pos, End: text.End})
 		if err != nil {
-			return fmt.Errorf("em: %w", err)
+			return err
 		}
-		scopes.Parent().Append(Em(text.Text))
-		return args.Finished()
+		rev := Revision{
+			Date: date,
+			Note: strings.TrimSpace(note),
+			forms: slices.Clone(scopes.frames),
+		}
+		i, _ := slices.BinarySearchFunc(blog.Meta.Revisions, rev, func(a, b Revision) int {
+			return a.Date.Compare(b.Date)
+		})
+		blog.Meta.Revisions = slices.Insert(blog.Meta.Revisions, i, rev)
+		return nil
+	},
+	"canonical": func(blog *Blog, scopes *Scopes, args *Args) error {
+		blog.Meta.CanonicalURL = strings.TrimSpace(string(args.Next().Text))
+		return nil
+	},
+	"description": func(blog *Blog, scopes *Scopes, args *Args) error {
+		description := args.Next()
+		blog.Meta.Description = string(description.Text)
+		if n := utf8.RuneCountInString(blog.Meta.Description); n > MaxDescriptionLength {
+			scopes.Warn(description.Pos, "description: %d characters long, search engines show about %d", n, MaxDescriptionLength)
+		}
+		return nil
+	},
+	"topic": func(blog *Blog, scopes *Scopes, args *Args) error {
+		blog.Meta.Topic = string(args.Next().Text)
+		return nil
+	},
+	"lang": func(blog *Blog, scopes *Scopes, args *Args) error {
+		blog.Meta.Language = strings.TrimSpace(string(args.Next().Text))
+		return nil
+	},
+	"site": siteFun,
+	"include": includeFun("include", func(node *Node) bool {
+		return formName(node) != "eof"
+	}),
+	"import": includeFun("import", func(node *Node) bool {
+		name := formName(node)
+		return name == "define" || name == "import"
+	}),
+	"em": func(blog *Blog, scopes *Scopes, args *Args) error {
+		scopes.Parent().Append(Em(args.Next().Text))
+		return nil
 	},
 }
 
+// MaxDescriptionLength is about the number of characters of a description
+// that search engines show.
+const MaxDescriptionLength = 160
+
+// DateFormat is the format of dates in be documents.
+const DateFormat = "2006-01-02"
+
+func parseDate(form string, date *Node) (time.Time, error) {
+	t, err := time.Parse(DateFormat, strings.TrimSpace(string(date.Text)))
+	if err != nil {
+		return t, fmt.Errorf("%s: %s: invalid date, want: YYYY-MM-DD, got: %q", date.Pos, form, string(date.Text))
+	}
+	return t, nil
+}
+
+// NewLink validates rawURL and creates a link to it.
+// Links to other hosts than the site's base URL are external.
+func NewLink(site Site, rawURL string) (*Link, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("malformed url: %w", err)
+	}
+	link := &Link{
+		Link: u.String(),
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("malformed url, missing host: %s", rawURL)
+		}
+		base, err := url.Parse(site.BaseURL)
+		link.External = err != nil || !strings.EqualFold(base.Host, u.Host)
+	case "mailto":
+		if _, err := mail.ParseAddress(u.Opaque); err != nil {
+			return nil, fmt.Errorf("malformed e-mail address: %s", u.Opaque)
+		}
+	case "tel":
+		if u.Opaque == "" || strings.TrimLeft(u.Opaque, "+0123456789-") != "" {
+			return nil, fmt.Errorf("malformed phone number: %s", u.Opaque)
+		}
+	case "":
+		// relative to the blog
+	default:
+		return nil, fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	return link, nil
+}
+
+// linkText is the text shown for links that do not have one.
+func linkText(rawURL string) string {
+	for _, scheme := range []string{"mailto:", "tel:"} {
+		if strings.HasPrefix(rawURL, scheme) {
+			return strings.TrimPrefix(rawURL, scheme)
+		}
+	}
+	return rawURL
+}
+
 func (blog *Blog) Eval(scopes *Scopes, el *Node) error {
 	switch el.Type {
 	case TypeAtom:
+		scopes.pushFrame(el)
+		defer scopes.popFrame()
 		fun, err := scopes.Resolve(string(el.Atom))
 		if err != nil {
-			return err
+			return scopes.evalError(fmt.Errorf("%s: %w", el.Pos, err))
+		}
+		if err := fun(blog, scopes, NewArgs(el)); err != nil {
+			return scopes.evalError(err)
 		}
-		return fun(blog, scopes, NewArgs(el.Next))
 	case TypeForm:
 		Unreachable()
 	case TypeText:
@@ -409,5 +528,5 @@ func (blog *Blog) Apply(parent CompositeRenderable, scopes *Scopes, node *Node)
 	case TypeAtom:
 		err = blog.Eval(scopes, node)
 	}
-	return err
+	return scopes.Recoverable(err)
 }
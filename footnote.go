@@ -0,0 +1,32 @@
+package be
+
+import (
+	"fmt"
+)
+
+const (
+	SidenotesInline = "inline"
+	SidenotesAsFootnotes = "footnotes"
+)
+
+// newFootnote adds a footnote, defined by the form at atom, to the blog and
+// marks it in parent.
+func (blog *Blog) newFootnote(parent CompositeRenderable, atom *Node) *Footnote {
+	number := len(blog.Footnotes) + 1
+	id := blog.anchor(blog.UniqueID(fmt.Sprintf("fn-%d", number)), atom)
+	footnote := NewFootnote(id, blog.UniqueID(fmt.Sprintf("fnref-%d", number)), number)
+	blog.Footnotes = append(blog.Footnotes, footnote)
+	parent.Append(&FootnoteRef{footnote})
+	return footnote
+}
+
+func footnoteFun(blog *Blog, scopes *Scopes, args *Args) error {
+	footnote := blog.newFootnote(scopes.Parent(), args.fun)
+	if err := blog.applyAll(footnote, scopes, args); err != nil {
+		return err
+	}
+	if len(footnote.Content) == 0 {
+		return fmt.Errorf("%s: footnote: empty footnote", args.fun.Pos)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Package format implements the canonical formatting of be sources.
+//
+// The canonical layout is:
+//   - no indentation
+//   - forms that contain prose or other block forms (like body, section and
+//     paragraph) span multiple lines, all other forms are kept on a single line
+//   - inside prose forms (like paragraph), there is one sentence per line
+//   - block forms are separated by blank lines, consecutive single line forms
+//     by a single newline
+//
+// Raw strings ('\+ ... \+') and escapes are preserved as written.
+// Formatting is idempotent and never changes how a document is evaluated.
+package format
+
+import (
+	"strings"
+
+	"be/lex"
+	"be/tok"
+)
+
+var (
+	// BlockForms are always laid out over multiple lines.
+	// Any form that contains a block form is a block form itself.
+	BlockForms = map[string]bool{
+		"body": true,
+		"section": true,
+		"subsection": true,
+		"paragraph": true,
+		"abstract": true,
+		"site": true,
+		"figure": true,
+		"list": true,
+		"enumerate": true,
+		"deflist": true,
+		"table": true,
+	}
+	// ProseForms are block forms whose content is written one sentence per
+	// line.
+	ProseForms = map[string]bool{
+		"paragraph": true,
+		"abstract": true,
+	}
+)
+
+type printer struct {
+	out strings.Builder
+}
+
+// Source formats the be document src.
+// name is only used in error messages.
+func Source(name string, src []byte) ([]byte, error) {
+	tokenizer := tok.NewSourceTokenizer(name, []rune(string(src)), nil)
+	tokenizer.Recover = true
+	tokenizer.Lossless = true
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	root, err := lex.Lex(tokens)
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{}
+	p.root(root.First.Next) // skip root atom
+	return []byte(p.out.String()), nil
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) root(nodes *lex.Node) {
+	var prev *lex.Node
+	for n := nodes; n != nil; n = n.Next {
+		if isEOF(n) {
+			continue
+		}
+		if prev != nil {
+			p.write(p.chunkSeparator(prev, n))
+		}
+		p.chunk(n)
+		prev = n
+	}
+	if prev != nil {
+		p.write("\n")
+	}
+}
+
+// isEOF reports whether n is the form inserted by the tokenizer at the end of
+// the document.
+func isEOF(n *lex.Node) bool {
+	return n.Type == lex.TypeForm && n.Raw == ""
+}
+
+func isBlock(n *lex.Node) bool {
+	if n.Type != lex.TypeForm || n.Form.First == nil || n.Form.First.Next == nil {
+		return false // empty forms fit on a single line
+	}
+	if BlockForms[atomOf(n)] {
+		return true
+	}
+	for c := n.Form.First; c != nil; c = c.Next {
+		if isBlock(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func atomOf(form *lex.Node) string {
+	if first := form.Form.First; first != nil && first.Type == lex.TypeAtom {
+		return string(first.Atom)
+	}
+	return ""
+}
+
+// chunk prints a node on its own line(s).
+func (p *printer) chunk(n *lex.Node) {
+	switch {
+	case isBlock(n):
+		p.block(n)
+	case n.Type == lex.TypeText:
+		text, _ := normalizeText(n, true)
+		p.write(text)
+	default:
+		p.inline(n)
+	}
+}
+
+// chunkSeparator separates nodes that are printed on their own line(s).
+func (p *printer) chunkSeparator(prev, next *lex.Node) string {
+	switch {
+	case prev.Type == lex.TypeText && next.Type == lex.TypeText:
+		if textSeparator(prev) != "" {
+			return separator(prev) + "\n"
+		}
+		return "\n\n"
+	case prev.Type == lex.TypeText:
+		if hasTrailingSpace(prev) {
+			return "\n" // a single newline before a form is read as a space
+		}
+		return "\n\n"
+	case isBlock(prev) || isBlock(next) || next.Type == lex.TypeText:
+		return "\n\n"
+	}
+	return "\n"
+}
+
+func (p *printer) block(n *lex.Node) {
+	atom := n.Form.First
+	p.write(string(tok.SymbolFormStart) + string(atom.Atom))
+	args := atom.Next
+	if args == nil {
+		p.write(string(tok.SymbolFormEnd))
+		return
+	}
+	hasBlocks := false
+	for a := args; a != nil; a = a.Next {
+		hasBlocks = hasBlocks || isBlock(a)
+	}
+	if ProseForms[string(atom.Atom)] && !hasBlocks {
+		p.write("\n")
+		p.inlines(args, true)
+		p.write("\n" + string(tok.SymbolFormEnd))
+		return
+	}
+	var prev *lex.Node
+	if args.Type == lex.TypeText { // heading
+		heading, _ := normalizeText(args, false)
+		p.write(" " + heading)
+		prev, args = args, args.Next
+	}
+	if args == nil {
+		p.write(string(tok.SymbolFormEnd))
+		return
+	}
+	if prev == nil {
+		p.write("\n\n")
+	}
+	for a := args; a != nil; a = a.Next {
+		if prev != nil {
+			p.write(p.chunkSeparator(prev, a))
+		}
+		p.chunk(a)
+		prev = a
+	}
+	p.write("\n" + string(tok.SymbolFormEnd))
+}
+
+func (p *printer) inline(n *lex.Node) {
+	atom := n.Form.First
+	p.write(string(tok.SymbolFormStart) + string(atom.Atom))
+	if atom.Next != nil {
+		p.write(" ")
+		p.inlines(atom.Next, false)
+	}
+	p.write(string(tok.SymbolFormEnd))
+}
+
+// inlines prints a sequence of arguments on a single line, or one sentence
+// per line if prose is set.
+func (p *printer) inlines(nodes *lex.Node, prose bool) {
+	for n := nodes; n != nil; n = n.Next {
+		if n.Type != lex.TypeText {
+			p.inline(n)
+			if n.Next != nil && n.Next.Leading != "" && tok.IsWhitespace([]rune(n.Next.Leading)[0]) {
+				p.write(" ") // white space after a form is insignificant, keep it as written
+			}
+			continue
+		}
+		text, sentenceEnd := normalizeText(n, prose)
+		p.write(text)
+		if n.Next == nil {
+			break
+		}
+		if n.Next.Type == lex.TypeText {
+			p.write(separator(n) + " ")
+		} else if hasTrailingSpace(n) { // the space before a form is significant
+			if prose && sentenceEnd {
+				p.write("\n") // a single newline before a form is read as a space
+			} else {
+				p.write(" ")
+			}
+		}
+	}
+}
+
+// normalizeText returns the source of a text node with white space
+// normalized and trailing white space removed.
+// If prose is set, every sentence is put on its own line.
+// sentenceEnd reports whether the text ends with a complete sentence.
+func normalizeText(n *lex.Node, prose bool) (text string, sentenceEnd bool) {
+	src := []rune(n.Raw)
+	out := &strings.Builder{}
+	space := false
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+		if r == ' ' || r == '\n' {
+			space = true
+			continue
+		}
+		if space {
+			if prose && sentenceEnd {
+				out.WriteRune('\n')
+			} else {
+				out.WriteRune(' ')
+			}
+			space = false
+		}
+		if r == tok.SymbolEscape && i+1 < len(src) {
+			if src[i+1] == tok.SymbolRawString { // copy raw string verbatim
+				end := i + 2
+				for end+1 < len(src) && !(src[end] == tok.SymbolEscape && src[end+1] == tok.SymbolRawString) {
+					end++
+				}
+				end = min(end+2, len(src))
+				out.WriteString(string(src[i:end]))
+				i = end - 1
+			} else {
+				out.WriteString(string(src[i:i+2]))
+				i++
+			}
+			sentenceEnd = false
+			continue
+		}
+		out.WriteRune(r)
+		sentenceEnd = isSentenceEnd(r) || (sentenceEnd && isClosing(r))
+	}
+	return out.String(), sentenceEnd
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '…'
+}
+
+func isClosing(r rune) bool {
+	return r == ')' || r == '"' || r == '\'' || r == '”' || r == '’'
+}
+
+func hasTrailingSpace(n *lex.Node) bool {
+	return strings.HasSuffix(n.Raw, " ") || strings.HasSuffix(n.Raw, "\n")
+}
+
+// separator returns the escape separating n from the text following it.
+// The space before the escape belongs to the text, so it is only written if
+// the source had one.
+func separator(n *lex.Node) string {
+	sep := textSeparator(n)
+	if sep == "" { // a blank line
+		return string([]rune{tok.SymbolEscape, tok.SymbolEscape})
+	}
+	if hasTrailingSpace(n) {
+		return " " + sep
+	}
+	return sep
+}
+
+// textSeparator returns the escape that separated n from the text following
+// it in the source, or the empty string if they were separated by a blank
+// line.
+func textSeparator(n *lex.Node) string {
+	if next := []rune(n.Next.Leading); len(next) >= 2 && next[0] == tok.SymbolEscape {
+		return string(next[:2])
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package format
+
+import (
+	"os"
+	"testing"
+
+	"be/tok"
+)
+
+// testSources returns the documents the formatter is tested on.
+func testSources(t *testing.T) []string {
+	t.Helper()
+	example, err := os.ReadFile("../blog_example.be")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{
+		string(example),
+		"{title Hello}",
+		"{title   Hello~World...}\n\n\n{tags a b}\n",
+		"{title Main\n\nAlt}",
+		"{title Main \\\\ Alt}",
+		"{title a\\\\b}",
+		"{title Main \n\nAlt}",
+		"{body\n{paragraph First sentence. Second sentence!\nThird {em sentence}.}\n\n{paragraph a \\\\ b}}\n",
+		"{body {paragraph a\\\\b \\\\ c\n\nd}}",
+		"{body {section Heading\n{paragraph text {sidenote short \\\\ long text} more}\n{subsection Sub {paragraph x}}}}",
+		"{body {section Heading\\\\ x\n\ny}}",
+		"{code :lang go \\+\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n\\+}\n",
+		"{list {item one} {item two {list {item nested}}}}",
+		"{define warn {params text} {paragraph {em Warning:} {text}}}\n{body {warn careful}}",
+	}
+}
+
+func TestSourceIdempotent(t *testing.T) {
+	for _, src := range testSources(t) {
+		once, err := Source("test.be", []byte(src))
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		twice, err := Source("test.be", once)
+		if err != nil {
+			t.Errorf("%q: formatted: %v", src, err)
+			continue
+		}
+		if string(once) != string(twice) {
+			t.Errorf("%q: not idempotent\nonce:\n%s\ntwice:\n%s", src, once, twice)
+		}
+	}
+}
+
+// Formatting must not change how a document is evaluated, so the formatted
+// document has to result in the same (cooked) tokens.
+func TestSourceKeepsTokens(t *testing.T) {
+	for _, src := range testSources(t) {
+		formatted, err := Source("test.be", []byte(src))
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		want, got := cookedTokens(t, src), cookedTokens(t, string(formatted))
+		if len(got) != len(want) {
+			t.Errorf("%q: want: %d tokens, got: %d\nformatted:\n%s", src, len(want), len(got), formatted)
+			continue
+		}
+		for i := range want {
+			if got[i].Type != want[i].Type || got[i].Text != want[i].Text {
+				t.Errorf("%q: token %d: want: %q, got: %q\nformatted:\n%s", src, i, want[i].Text, got[i].Text, formatted)
+				break
+			}
+		}
+	}
+}
+
+func cookedTokens(t *testing.T, src string) []tok.Token {
+	t.Helper()
+	tokens, err := tok.NewTokenizer([]rune(src)).Tokenize()
+	if err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	return tokens
+}
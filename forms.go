@@ -0,0 +1,616 @@
+package be
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	. "be/internal/debug"
+	"be/lex"
+)
+
+// Signature declares the arguments of a form, and documents it for tooling
+// (like the language server and be doc).
+// Forms are checked against their signature before they are evaluated, so
+// that wrong arguments are reported the same way for every form.
+type Signature struct {
+	Name string
+	Usage string
+	Doc string
+	Params []Param // positional parameters
+	Keywords []Param
+	// Parents are the forms in which this form is registered, forms without
+	// Parents are available everywhere.
+	Parents []string
+	// Internal forms are inserted by the tokenizer and not meant to be
+	// written by authors.
+	Internal bool
+}
+
+// Param is a parameter of a form.
+// Text separated by \\ (or empty lines) is passed as multiple arguments.
+type Param struct {
+	Name string
+	Type lex.FormType
+	// Optional parameters are skipped if the argument is of another type.
+	Optional bool
+	// Variadic parameters take any number of arguments (including none),
+	// they must come last.
+	Variadic bool
+	Default string // keywords only
+	Doc string
+}
+
+var signatures = map[string]Signature{
+	"root": {
+		Usage: "{root ...}",
+		Doc: "Encloses the whole document, inserted automatically.",
+		Params: []Param{
+			{Name: "forms", Type: TypeForm, Variadic: true},
+		},
+		Internal: true,
+	},
+	"eof": {
+		Usage: "{eof}",
+		Doc: "Marks the end of the document, inserted automatically.",
+		Internal: true,
+	},
+	"html-comment": {
+		Usage: "{html-comment text}",
+		Doc: "A comment that is kept in the generated HTML.",
+		Params: []Param{
+			{Name: "text", Type: TypeText},
+		},
+	},
+	"comment": {
+		Usage: "{comment ...}",
+		Doc: "A comment, its content is ignored.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"title": {
+		Usage: "{title text [alternative title]}",
+		Doc: "Title of the blog post.",
+		Params: []Param{
+			{Name: "title", Type: TypeText},
+			{Name: "alternative title", Type: TypeText, Optional: true},
+		},
+	},
+	"author": {
+		Usage: "{author {name text} {email text}}",
+		Doc: "Author of the blog post.",
+		Params: []Param{
+			{Name: "name and email", Type: TypeForm, Variadic: true},
+		},
+	},
+	"name": {
+		Usage: "{name text}",
+		Doc: "Name of the author.",
+		Params: []Param{
+			{Name: "name", Type: TypeText},
+		},
+		Parents: []string{"author"},
+	},
+	"email": {
+		Usage: "{email text}",
+		Doc: "E-mail address of the author.",
+		Params: []Param{
+			{Name: "email", Type: TypeText},
+		},
+		Parents: []string{"author"},
+	},
+	"tags": {
+		Usage: "{tags space separated tags...}",
+		Doc: "Tags (keywords) of the blog post.",
+		Params: []Param{
+			{Name: "tags", Type: TypeText, Variadic: true},
+		},
+	},
+	"body": {
+		Usage: "{body content...}",
+		Doc: "Content of the blog post.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"paragraph": {
+		Usage: "{paragraph content...}",
+		Doc: "A paragraph of text.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"section": {
+		Usage: "{section heading content...}",
+		Doc: "A section with a heading, can contain subsections.",
+		Params: []Param{
+			{Name: "heading", Type: TypeText},
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"subsection": {
+		Usage: "{subsection heading content...}",
+		Doc: "A subsection with a heading.",
+		Params: []Param{
+			{Name: "heading", Type: TypeText},
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"section"},
+	},
+	"abstract": {
+		Usage: "{abstract content...}",
+		Doc: "Summary of the blog post.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"enquote": {
+		Usage: "{enquote text}",
+		Doc: "Quoted text.",
+		Params: []Param{
+			{Name: "text", Type: TypeText},
+		},
+	},
+	"sidenote": {
+		Usage: "{sidenote short text content...}",
+		Doc: "A note shown in the margin, or expanded when short text is clicked.",
+		Params: []Param{
+			{Name: "short text", Type: TypeText},
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"mono": {
+		Usage: "{mono text}",
+		Doc: "Inline monospace text (code).",
+		Params: []Param{
+			{Name: "text", Type: TypeText},
+		},
+	},
+	"code": {
+		Usage: "{code :lang go :file main.go :start 10 :highlight 3-5,8 \\+...\\+}",
+		Doc: "A code block, usually written as raw string: \\+ ... \\+. The optional keywords set the language to highlight (go, c, sh, lisp, config), the file name shown above, the number of the first line, and the lines to emphasize.",
+		Keywords: []Param{
+			{Name: "lang", Type: TypeText, Doc: "Language to highlight: go, c, sh, lisp or config."},
+			{Name: "file", Type: TypeText, Doc: "File name shown above the code."},
+			{Name: "start", Type: TypeText, Default: "1", Doc: "Number of the first line."},
+			{Name: "highlight", Type: TypeText, Doc: "Lines to emphasize, counted from 1: 3-5,8."},
+		},
+		Params: []Param{
+			{Name: "code", Type: TypeText},
+		},
+	},
+	"em": {
+		Usage: "{em text}",
+		Doc: "Emphasized text.",
+		Params: []Param{
+			{Name: "text", Type: TypeText},
+		},
+	},
+	"define": {
+		Usage: "{define name {params a b...} body...}",
+		Doc: "Defines a macro, a new form that expands to body. Within body, the parameters are forms like {a}, expanding to the arguments.",
+		Params: []Param{
+			{Name: "name", Type: TypeText},
+			{Name: "body", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"link": {
+		Usage: "{link url text...}",
+		Doc: "A hyperlink, links to other sites open in a new tab. Supported are http(s), mailto: and tel: urls, and urls relative to the blog.",
+		Params: []Param{
+			{Name: "url and text", Type: TypeText},
+			{Name: "text", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"ref": {
+		Usage: "{ref url}",
+		Doc: "A hyperlink showing the url as its text.",
+		Params: []Param{
+			{Name: "url", Type: TypeText},
+		},
+	},
+	"list": {
+		Usage: "{list {item content...}...}",
+		Doc: "An unordered (bullet) list.",
+		Params: []Param{
+			{Name: "items", Type: TypeForm, Variadic: true},
+		},
+	},
+	"enumerate": {
+		Usage: "{enumerate [start] {item content...}...}",
+		Doc: "An ordered (numbered) list, numbered from start (default 1).",
+		Params: []Param{
+			{Name: "start", Type: TypeText, Optional: true},
+			{Name: "items", Type: TypeForm, Variadic: true},
+		},
+	},
+	"item": {
+		Usage: "{item content...}",
+		Doc: "An item of a list, can contain nested lists.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"list", "enumerate"},
+	},
+	"deflist": {
+		Usage: "{deflist {term content...} {def content...}...}",
+		Doc: "A definition list, each term is followed by its definitions.",
+		Params: []Param{
+			{Name: "terms and definitions", Type: TypeForm, Variadic: true},
+		},
+	},
+	"term": {
+		Usage: "{term content...}",
+		Doc: "A term of a definition list.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"deflist"},
+	},
+	"def": {
+		Usage: "{def content...}",
+		Doc: "The definition of the preceding term.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"deflist"},
+	},
+	"footnote": {
+		Usage: "{footnote content...}",
+		Doc: "A numbered note, listed at the end of the post.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"table": {
+		Usage: "{table {align left...} {caption content...} {header cells...} {row cells...}...}",
+		Doc: "A numbered table, it can be linked to with #table-N. Every argument of a row is a cell, separate text cells with \\\\.",
+		Params: []Param{
+			{Name: "rows", Type: TypeForm, Variadic: true},
+		},
+	},
+	"table-csv": {
+		Usage: "{table-csv {align left...} {caption content...} \\+ comma separated values \\+}",
+		Doc: "A numbered table written as comma separated values, the first record is the header.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+	},
+	"align": {
+		Usage: "{align left|right|center...}",
+		Doc: "Alignment of each column of a table.",
+		Params: []Param{
+			{Name: "alignments", Type: TypeText},
+		},
+		Parents: []string{"table", "table-csv"},
+	},
+	"header": {
+		Usage: "{header cells...}",
+		Doc: "A header row of a table.",
+		Params: []Param{
+			{Name: "cells", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"table"},
+	},
+	"row": {
+		Usage: "{row cells...}",
+		Doc: "A row of a table.",
+		Params: []Param{
+			{Name: "cells", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"table"},
+	},
+	"cell": {
+		Usage: "{cell content...}",
+		Doc: "A table cell with rich content.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"header", "row"},
+	},
+	"span": {
+		Usage: "{span columns content...}",
+		Doc: "A table cell spanning multiple columns.",
+		Params: []Param{
+			{Name: "columns", Type: TypeText},
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"header", "row"},
+	},
+	"image": {
+		Usage: "{image path alt text}",
+		Doc: "An image, the alt text describing it is required. Paths starting with / are relative to the site root, others to the file.",
+		Params: []Param{
+			{Name: "path and alt text", Type: TypeText},
+		},
+	},
+	"figure": {
+		Usage: "{figure {image path alt text} {caption content...}}",
+		Doc: "A numbered figure with an optional caption, it can be linked to with #figure-N.",
+		Params: []Param{
+			{Name: "image and caption", Type: TypeForm, Variadic: true},
+		},
+	},
+	"caption": {
+		Usage: "{caption content...}",
+		Doc: "Caption of a figure or table.",
+		Params: []Param{
+			{Name: "content", Type: TypeText | TypeForm, Variadic: true},
+		},
+		Parents: []string{"figure", "table", "table-csv"},
+	},
+	"published": {
+		Usage: "{published YYYY-MM-DD}",
+		Doc: "Publication date, posts without one are drafts.",
+		Params: []Param{
+			{Name: "date", Type: TypeText},
+		},
+	},
+	"revised": {
+		Usage: "{revised YYYY-MM-DD what changed}",
+		Doc: "A revision of the post, listed in the changelog.",
+		Params: []Param{
+			{Name: "date and note", Type: TypeText},
+		},
+	},
+	"canonical": {
+		Usage: "{canonical url}",
+		Doc: "Canonical URL of the post, defaults to the post under the site's base-url.",
+		Params: []Param{
+			{Name: "url", Type: TypeText},
+		},
+	},
+	"description": {
+		Usage: "{description text}",
+		Doc: "Description of the post for search engines and link previews.",
+		Params: []Param{
+			{Name: "text", Type: TypeText},
+		},
+	},
+	"topic": {
+		Usage: "{topic text}",
+		Doc: "Topic (subject) of the post.",
+		Params: []Param{
+			{Name: "topic", Type: TypeText},
+		},
+	},
+	"lang": {
+		Usage: "{lang code}",
+		Doc: "Language (ISO 639) of the post, defaults to the site's language.",
+		Params: []Param{
+			{Name: "code", Type: TypeText},
+		},
+	},
+	"site": {
+		Usage: "{site configuration...}",
+		Doc: "Site-wide configuration (usually in site.be), used in a post it overrides the configuration for that post only.",
+		Params: []Param{
+			{Name: "configuration", Type: TypeForm, Variadic: true},
+		},
+	},
+	"blog-name": {
+		Usage: "{blog-name text}",
+		Doc: "Name of the blog.",
+		Params: []Param{
+			{Name: "name", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"base-url": {
+		Usage: "{base-url url}",
+		Doc: "URL under which the blog is published.",
+		Params: []Param{
+			{Name: "url", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"language": {
+		Usage: "{language code}",
+		Doc: "Default language (ISO 639) of the posts.",
+		Params: []Param{
+			{Name: "code", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"nav-link": {
+		Usage: "{nav-link label url}",
+		Doc: "A link in the navigation bar, the first nav-link replaces the default links.",
+		Params: []Param{
+			{Name: "label and url", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"output-dir": {
+		Usage: "{output-dir path}",
+		Doc: "Directory the generated HTML is written to.",
+		Params: []Param{
+			{Name: "path", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"words-per-minute": {
+		Usage: "{words-per-minute number}",
+		Doc: "Reading speed used to estimate the reading time of posts.",
+		Params: []Param{
+			{Name: "number", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"image-widths": {
+		Usage: "{image-widths 480 960...}",
+		Doc: "Widths in pixels of the downscaled variants generated for images, no variants are generated by default.",
+		Params: []Param{
+			{Name: "widths", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"image-dir": {
+		Usage: "{image-dir path}",
+		Doc: "Directory (relative to the site root) the image variants are stored in.",
+		Params: []Param{
+			{Name: "path", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"sidenotes": {
+		Usage: "{sidenotes inline|footnotes}",
+		Doc: "Whether sidenotes are shown in the margin (inline), or rendered as footnotes.",
+		Params: []Param{
+			{Name: "mode", Type: TypeText},
+		},
+		Parents: []string{"site"},
+	},
+	"include": {
+		Usage: "{include path}",
+		Doc: "Evaluates the forms of another file at this point, path is relative to the including file.",
+		Params: []Param{
+			{Name: "path", Type: TypeText},
+		},
+	},
+	"import": {
+		Usage: "{import path}",
+		Doc: "Makes the definitions (macros) of another file available, path is relative to the importing file.",
+		Params: []Param{
+			{Name: "path", Type: TypeText},
+		},
+	},
+	"params": {
+		Usage: "{params a b...}",
+		Doc: "Parameter names of a macro.",
+		Params: []Param{
+			{Name: "names", Type: TypeText, Variadic: true},
+		},
+		Parents: []string{"define"},
+	},
+}
+
+func init() {
+	for name, sig := range signatures {
+		sig.Name = name
+		signatures[name] = sig
+	}
+	for name, fun := range rootFuns {
+		_, ok := signatures[name]
+		Assert(ok, fmt.Sprintf("form %s has no signature", name))
+		rootFuns[name] = checked(name, fun)
+	}
+}
+
+// checked returns fun, checking that the form name is used within one of its
+// parents, and its arguments against its signature first (if there is one).
+// Keyword arguments are only parsed for forms declaring keywords, the text
+// of other forms may start with a colon.
+func checked(name string, fun beFun) beFun {
+	sig, ok := signatures[name]
+	if !ok {
+		return fun
+	}
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		if len(sig.Parents) > 0 {
+			if parent := scopes.enclosingForm(); !slices.Contains(sig.Parents, parent) {
+				return fmt.Errorf("%s: %s: only allowed within {%s}, not {%s}", args.fun.Pos, name, strings.Join(sig.Parents, "} or {"), parent)
+			}
+		}
+		if len(sig.Keywords) > 0 {
+			if err := args.parseKeywords(); err != nil {
+				return err
+			}
+		}
+		scopes.labelFrame(args)
+		if err := sig.Check(args); err != nil {
+			return err
+		}
+		args.sig = &sig
+		return fun(blog, scopes, args)
+	}
+}
+
+// enclosingForm returns the name of the form enclosing the current one.
+// Macros and their parameters are skipped, the forms they expand to are
+// enclosed by the form the macro is used in.
+func (s *Scopes) enclosingForm() string {
+	for i := len(s.frames)-2; i >= 0; i-- {
+		if _, ok := signatures[s.frames[i].Name]; ok {
+			return s.frames[i].Name
+		}
+	}
+	return ""
+}
+
+// Check reports whether the (remaining) args match the signature, without
+// consuming them.
+func (sig Signature) Check(args *Args) error {
+	for _, kw := range args.keywords {
+		i := slices.IndexFunc(sig.Keywords, func(p Param) bool {
+			return p.Name == kw.name
+		})
+		if i < 0 {
+			return fmt.Errorf("%s: %s: unknown keyword argument: :%s", kw.pos, sig.Name, kw.name)
+		}
+		if want := sig.Keywords[i].Type; (kw.value.Type & want) == 0 {
+			return fmt.Errorf("%s: %s: keyword argument of incorrect type: :%s, want: %s, got: %s", kw.value.Pos, sig.Name, kw.name, want, kw.value.Type)
+		}
+	}
+	arg := args.next
+	for _, param := range sig.Params {
+		matched := false
+		for arg != nil && (!matched || param.Variadic) {
+			if (arg.Type & param.Type) == 0 {
+				if param.Optional {
+					break
+				}
+				return fmt.Errorf("%s: %s: argument of incorrect type: %s, want: %s, got: %s", arg.Pos, sig.Name, param.Name, param.Type, arg.Type)
+			}
+			arg = arg.Next
+			matched = true
+		}
+		if !matched && !param.Optional && !param.Variadic {
+			return fmt.Errorf("%s: %s: missing argument: %s", args.fun.Pos, sig.Name, param.Name)
+		}
+	}
+	if arg != nil {
+		return fmt.Errorf("%s: %s: superfluous argument: %s", arg.Pos, sig.Name, arg.Type)
+	}
+	return nil
+}
+
+// Forms returns the signatures of all forms, sorted by name.
+func Forms() (sigs []Signature) {
+	for _, sig := range signatures {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool {
+		return sigs[i].Name < sigs[j].Name
+	})
+	return sigs
+}
+
+func LookupForm(name string) (Signature, bool) {
+	sig, ok := signatures[name]
+	return sig, ok
+}
+
+// FormsInScope returns the forms that can be written inside of the forms
+// enclosing (outermost first).
+// As when evaluating, only the innermost enclosing form counts, macros are
+// skipped.
+func FormsInScope(enclosing []string) (sigs []Signature) {
+	parent := ""
+	for i := len(enclosing)-1; i >= 0; i-- {
+		if _, ok := signatures[enclosing[i]]; ok {
+			parent = enclosing[i]
+			break
+		}
+	}
+	for _, sig := range Forms() {
+		if sig.Internal {
+			continue
+		}
+		if len(sig.Parents) == 0 || slices.Contains(sig.Parents, parent) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
@@ -0,0 +1,169 @@
+package be
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"be/internal/resize"
+	"be/tok"
+)
+
+// imagePath returns the file an image src refers to.
+// Absolute sources are relative to the site root, others to the directory of
+// the file containing pos.
+func (s Site) imagePath(pos tok.Position, src string) string {
+	if strings.HasPrefix(src, "/") {
+		return filepath.Join(s.Root, filepath.FromSlash(strings.TrimPrefix(src, "/")))
+	}
+	return resolvePath(pos, filepath.FromSlash(src))
+}
+
+// NewImage reads the dimensions of the image at path, and generates the
+// variants configured for site, unless dryRun is set.
+func NewImage(site Site, src, path, alt string, dryRun bool) (*Image, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(bs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	img := &Image{
+		Src: src,
+		Alt: alt,
+		Width: config.Width,
+		Height: config.Height,
+	}
+	if dryRun {
+		return img, nil
+	}
+	img.Variants, err = generateVariants(site, bs, format, path, config.Width)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(img.Variants) > 0 {
+		img.Variants = append(img.Variants, ImageVariant{src, config.Width})
+	}
+	return img, nil
+}
+
+// generateVariants downscales the image to the configured widths (smaller
+// than the image itself).
+// The variants are named by the hash of the image's content, so variants
+// that already exist are up to date and not generated again.
+func generateVariants(site Site, bs []byte, format, path string, width int) (variants []ImageVariant, err error) {
+	hash := sha256.Sum256(bs)
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+	var decoded image.Image
+	for _, w := range site.ImageWidths {
+		if w >= width {
+			continue
+		}
+		name := fmt.Sprintf("%s-%x-%dw%s", stem, hash[:6], w, ext)
+		url := filepath.Join(site.ImageDir, name)
+		file := filepath.Join(site.Root, url)
+		variants = append(variants, ImageVariant{
+			URL: "/" + filepath.ToSlash(url),
+			Width: w,
+		})
+		if _, err := os.Stat(file); err == nil {
+			continue
+		}
+		if decoded == nil {
+			decoded, _, err = image.Decode(bytes.NewReader(bs))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := writeVariant(file, resize.Width(decoded, w), format); err != nil {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+func writeVariant(file string, img image.Image, format string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	// write to a temporary file first, so that an interrupted build does not
+	// leave a broken variant that is considered up to date
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if format == "jpeg" {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(f, img)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func imageFun(blog *Blog, scopes *Scopes, args *Args) error {
+	text := args.Next()
+	// the path is the first word, followed by the alt text
+	src, alt, _ := strings.Cut(strings.TrimLeftFunc(string(text.Text), tok.IsWhitespace), " ")
+	alt = strings.TrimSpace(alt)
+	if alt == "" {
+		return fmt.Errorf("%s: image: missing alt text, describe the image for readers that cannot see it", text.Pos)
+	}
+	img, err := NewImage(blog.Site, src, blog.Site.imagePath(text.Pos, src), alt, scopes.DryRun)
+	if err != nil {
+		return fmt.Errorf("%s: image: %w", text.Pos, err)
+	}
+	scopes.Parent().Append(img)
+	return nil
+}
+
+func figureFun(blog *Blog, scopes *Scopes, args *Args) error {
+	blog.figures++
+	id := blog.anchor(blog.UniqueID(fmt.Sprintf("figure-%d", blog.figures)), args.fun)
+	figure := NewFigure(id, blog.figures)
+	scopes.RegisterFun("caption", captionFun("figure", &figure.Caption))
+	for content := args.Next(); content != nil; content = args.Next() {
+		if name := formName(content); name != "image" && name != "caption" {
+			return fmt.Errorf("%s: figure: want: {image} or {caption}, got: {%s}", content.Pos, name)
+		}
+		if err := blog.Apply(figure, scopes, content); err != nil {
+			return err
+		}
+	}
+	if len(figure.Images) == 0 {
+		return fmt.Errorf("%s: figure: missing image", args.fun.Pos)
+	}
+	scopes.Parent().Append(figure)
+	return nil
+}
+
+// captionFun returns the form setting the caption of a figure or table.
+func captionFun(of string, caption **Caption) beFun {
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		if *caption != nil {
+			return fmt.Errorf("%s: caption: %s already has a caption", args.fun.Pos, of)
+		}
+		*caption = &Caption{}
+		return blog.applyAll(*caption, scopes, args)
+	}
+}
@@ -0,0 +1,132 @@
+package be
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"be/lex"
+	"be/tok"
+)
+
+// IncludeError is an error in an included (or imported) file, together with
+// the chain of includes that led to it.
+type IncludeError struct {
+	Err error
+	Chain []tok.Position // include sites, innermost first
+}
+
+func (e IncludeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Err.Error())
+	for _, site := range e.Chain {
+		sb.WriteString("\n\tincluded from ")
+		sb.WriteString(site.String())
+	}
+	return sb.String()
+}
+
+func (e IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// includeFun returns a form that evaluates the forms of another file,
+// resolved relative to the file containing the form.
+// Only the nodes for which keep returns true are evaluated.
+// Definitions made by the file are visible after the form.
+func includeFun(name string, keep func(node *Node) bool) beFun {
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		pathArg := args.Next()
+		site := args.fun.Pos
+		path := resolvePath(site, strings.TrimSpace(string(pathArg.Text)))
+		if chain := scopes.includeCycle(site, path); chain != nil {
+			return fmt.Errorf("%s: %s: cycle: %s", site, name, strings.Join(chain, " -> "))
+		}
+		root, err := scopes.parse(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("%s: %s: %w", pathArg.Pos, name, err)
+			}
+			return IncludeError{err, []tok.Position{site}}
+		}
+		scopes.includes = append(scopes.includes, site)
+		defer func() {
+			scopes.includes = scopes.includes[:len(scopes.includes)-1]
+		}()
+		for content := root.First.Next; content != nil; content = content.Next {
+			if !keep(content) {
+				continue
+			}
+			if err := blog.Apply(scopes.Parent(), scopes, content); err != nil {
+				var inclErr IncludeError
+				if errors.As(err, &inclErr) {
+					inclErr.Chain = append(inclErr.Chain, site)
+					return inclErr
+				}
+				return IncludeError{err, []tok.Position{site}}
+			}
+		}
+		for def, fun := range scopes.Top().funs {
+			if err := scopes.Define(def, fun, scopes.Top().defs[def]); err != nil {
+				return fmt.Errorf("%s: %s: %w", site, name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// resolvePath resolves path relative to the directory of the file
+// containing site.
+func resolvePath(site tok.Position, path string) string {
+	if filepath.IsAbs(path) || site.Source == nil || strings.HasPrefix(site.Source.Name, "<") {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(site.Source.Name), path)
+}
+
+// includeCycle returns the chain of files that include each other, if path
+// is already being evaluated, otherwise nil.
+func (s *Scopes) includeCycle(site tok.Position, path string) []string {
+	var files []string
+	for _, pos := range append(s.includes, site) {
+		files = append(files, pos.FileName())
+	}
+	for i, file := range files {
+		if samePath(file, path) {
+			return append(files[i:], path)
+		}
+	}
+	return nil
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// samePosition reports whether a and b are the same position in the same
+// file, even if it was read more than once.
+func samePosition(a, b tok.Position) bool {
+	return a.IsValid() && a.Offset == b.Offset && samePath(a.FileName(), b.FileName())
+}
+
+// parse reads, tokenizes and lexes the file at path.
+func (s *Scopes) parse(path string) (*Head, error) {
+	if s.Sources == nil {
+		s.Sources = tok.NewSources()
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokenizer := tok.NewSourceTokenizer(path, []rune(string(bs)), s.Sources)
+	tokenizer.Recover = true
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	return lex.Lex(tokens)
+}
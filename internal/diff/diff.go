@@ -0,0 +1,157 @@
+// Package diff renders line based differences in the unified format.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const context = 3
+
+type (
+	op int
+	edit struct {
+		op op
+		line string
+	}
+)
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+// Unified returns the differences between old and new in the unified
+// diff format, or the empty string if there are none.
+func Unified(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	edits := lcs(splitLines(old), splitLines(new))
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 1, 1 // line numbers at edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// collect a hunk: changes that are at most 2*context lines apart
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].op != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == opEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		body := &strings.Builder{}
+		for _, e := range edits[start:end] {
+			switch e.op {
+			case opEqual:
+				oldCount++
+				newCount++
+				body.WriteString(" " + e.line)
+			case opDelete:
+				oldCount++
+				body.WriteString("-" + e.line)
+			case opInsert:
+				newCount++
+				body.WriteString("+" + e.line)
+			}
+			if !strings.HasSuffix(e.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(out, "@@ -%s +%s @@\n%s", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount), body)
+		for _, e := range edits[i:end] {
+			if e.op != opInsert {
+				oldLine++
+			}
+			if e.op != opDelete {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start-- // empty ranges refer to the line before
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits s after each newline, keeping the newlines.
+func splitLines(s string) (lines []string) {
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// lcs computes a minimal edit script turning a into b, using the longest
+// common subsequence of both.
+func lcs(a, b []string) (edits []edit) {
+	n, m := len(a), len(b)
+	// table[i][j]: length of the lcs of a[i:] and b[j:]
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n-1; i >= 0; i-- {
+		for j := m-1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		if a[i] == b[j] {
+			edits = append(edits, edit{opEqual, a[i]})
+			i++
+			j++
+		} else if table[i+1][j] >= table[i][j+1] {
+			edits = append(edits, edit{opDelete, a[i]})
+			i++
+		} else {
+			edits = append(edits, edit{opInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, edit{opDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, edit{opInsert, b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,246 @@
+// Package highlight is a simple syntax highlighter.
+// It only distinguishes keywords, strings, comments and numbers, which is
+// good enough for the snippets in blog posts.
+package highlight
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	Class string
+	Span struct {
+		Class Class // empty for plain text
+		Text string
+	}
+	language struct {
+		keywords []string
+		lineComments []string
+		blockComment [2]string
+		quotes string // characters that start (and end) a string
+		multilineQuotes string // quotes whose strings may span lines
+		identRune func(r rune) bool
+		// keyAtLineStart highlights the first word of every line as keyword
+		// (configuration files).
+		keyAtLineStart bool
+	}
+)
+
+const (
+	Keyword Class = "keyword"
+	String Class = "string"
+	Comment Class = "comment"
+	Number Class = "number"
+)
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isLispIdentRune(r rune) bool {
+	return isIdentRune(r) || strings.ContainsRune("-+*/<>=!?:&%", r)
+}
+
+var (
+	golang = &language{
+		keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false", "iota"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes: "\"'`",
+		multilineQuotes: "`",
+		identRune: isIdentRune,
+	}
+	c = &language{
+		keywords: []string{"auto", "break", "case", "char", "const", "continue", "default", "do", "double", "else", "enum", "extern", "float", "for", "goto", "if", "inline", "int", "long", "register", "restrict", "return", "short", "signed", "sizeof", "static", "struct", "switch", "typedef", "union", "unsigned", "void", "volatile", "while", "NULL", "#include", "#define", "#ifdef", "#ifndef", "#endif", "#if", "#else"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes: "\"'",
+		identRune: func(r rune) bool {
+			return isIdentRune(r) || r == '#'
+		},
+	}
+	shell = &language{
+		keywords: []string{"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done", "case", "esac", "in", "function", "return", "export", "local", "set", "unset", "echo", "cd", "exit"},
+		lineComments: []string{"#"},
+		quotes: "\"'",
+		multilineQuotes: "\"'",
+		identRune: func(r rune) bool {
+			// paths and options are words, too, so that keywords are not
+			// highlighted within them
+			return isIdentRune(r) || strings.ContainsRune("-./~+:@%", r)
+		},
+	}
+	lisp = &language{
+		keywords: []string{"defun", "defmacro", "defvar", "defparameter", "define", "lambda", "let", "let*", "letrec", "if", "cond", "when", "unless", "and", "or", "not", "progn", "begin", "loop", "setq", "setf", "quote", "nil", "t"},
+		lineComments: []string{";"},
+		blockComment: [2]string{"#|", "|#"},
+		quotes: "\"",
+		multilineQuotes: "\"",
+		identRune: isLispIdentRune,
+	}
+	config = &language{
+		lineComments: []string{"#", ";"},
+		quotes: "\"",
+		identRune: func(r rune) bool {
+			return isIdentRune(r) || r == '-' || r == '.'
+		},
+		keyAtLineStart: true,
+	}
+	languages = map[string]*language{
+		"go": golang,
+		"c": c,
+		"h": c,
+		"sh": shell,
+		"bash": shell,
+		"shell": shell,
+		"lisp": lisp,
+		"scheme": lisp,
+		"elisp": lisp,
+		"config": config,
+		"conf": config,
+		"ini": config,
+		"ssh-config": config,
+	}
+)
+
+// Supported reports whether lang can be highlighted.
+func Supported(lang string) bool {
+	_, ok := languages[lang]
+	return ok
+}
+
+// Lines highlights src written in lang and splits it into lines.
+// Unsupported languages are not highlighted.
+func Lines(lang, src string) (lines [][]Span) {
+	line := []Span{}
+	for _, span := range tokenize(languages[lang], src) {
+		parts := strings.Split(span.Text, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				lines = append(lines, line)
+				line = []Span{}
+			}
+			if part != "" {
+				line = append(line, Span{span.Class, part})
+			}
+		}
+	}
+	return append(lines, line)
+}
+
+func tokenize(lang *language, src string) (spans []Span) {
+	if lang == nil {
+		return []Span{{"", src}}
+	}
+	emit := func(class Class, text string) {
+		if n := len(spans); n > 0 && spans[n-1].Class == class {
+			spans[n-1].Text += text
+			return
+		}
+		spans = append(spans, Span{class, text})
+	}
+	lineStart := true
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		r, size := utf8.DecodeRuneInString(rest)
+		if r == '\n' {
+			emit("", "\n")
+			i += size
+			lineStart = true
+			continue
+		}
+		if r == ' ' || r == '\t' {
+			emit("", string(r))
+			i += size
+			continue
+		}
+		if n := lang.comment(rest); n > 0 {
+			emit(Comment, rest[:n])
+			i += n
+			continue
+		}
+		if strings.ContainsRune(lang.quotes, r) {
+			n := lang.stringLength(rest, r)
+			emit(String, rest[:n])
+			i += n
+			lineStart = false
+			continue
+		}
+		if unicode.IsDigit(r) {
+			n := strings.IndexFunc(rest, func(r rune) bool {
+				return !(isIdentRune(r) || r == '.')
+			})
+			if n < 0 {
+				n = len(rest)
+			}
+			emit(Number, rest[:n])
+			i += n
+			lineStart = false
+			continue
+		}
+		if lang.identRune(r) {
+			n := strings.IndexFunc(rest, func(r rune) bool {
+				return !lang.identRune(r)
+			})
+			if n < 0 {
+				n = len(rest)
+			}
+			word := rest[:n]
+			class := Class("")
+			if (lang.keyAtLineStart && lineStart) || slices.Contains(lang.keywords, word) {
+				class = Keyword
+			}
+			emit(class, word)
+			i += n
+			lineStart = false
+			continue
+		}
+		emit("", string(r))
+		i += size
+		lineStart = false
+	}
+	return spans
+}
+
+// comment returns the length of the comment at the start of s, or 0.
+func (lang *language) comment(s string) int {
+	for _, prefix := range lang.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			if n := strings.IndexByte(s, '\n'); n >= 0 {
+				return n
+			}
+			return len(s)
+		}
+	}
+	if start, end := lang.blockComment[0], lang.blockComment[1]; start != "" && strings.HasPrefix(s, start) {
+		if n := strings.Index(s[len(start):], end); n >= 0 {
+			return len(start) + n + len(end)
+		}
+		return len(s)
+	}
+	return 0
+}
+
+// stringLength returns the length of the string starting with quote at the
+// start of s. Unterminated strings end at the end of the line.
+func (lang *language) stringLength(s string, quote rune) int {
+	multiline := strings.ContainsRune(lang.multilineQuotes, quote)
+	escaped := false
+	for i, r := range s {
+		switch {
+		case i == 0:
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '`':
+			escaped = true
+		case r == quote:
+			return i + utf8.RuneLen(r)
+		case r == '\n' && !multiline:
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,54 @@
+// Package resize downscales images in pure Go.
+package resize
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Width scales src down to width pixels, keeping the aspect ratio.
+// Every pixel of the result is the average of the source pixels it covers,
+// weighted by the covered area (box filter), which avoids the aliasing of
+// nearest neighbour sampling when downscaling by large factors.
+func Width(src image.Image, width int) *image.NRGBA {
+	b := src.Bounds()
+	height := max(1, int(math.Round(float64(b.Dy())*float64(width)/float64(b.Dx()))))
+	// premultiplied alpha, so that transparent pixels do not bleed their
+	// color into the average
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(b.Dx()) / float64(width)
+	scaleY := float64(b.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		y0, y1 := float64(y)*scaleY, float64(y+1)*scaleY
+		for x := 0; x < width; x++ {
+			x0, x1 := float64(x)*scaleX, float64(x+1)*scaleX
+			var sum [4]float64
+			var area float64
+			for sy := int(y0); float64(sy) < y1 && sy < b.Dy(); sy++ {
+				wy := math.Min(y1, float64(sy+1)) - math.Max(y0, float64(sy))
+				for sx := int(x0); float64(sx) < x1 && sx < b.Dx(); sx++ {
+					w := wy * (math.Min(x1, float64(sx+1)) - math.Max(x0, float64(sx)))
+					i := rgba.PixOffset(sx, sy)
+					for c := range sum {
+						sum[c] += w * float64(rgba.Pix[i+c])
+					}
+					area += w
+				}
+			}
+			i := dst.PixOffset(x, y)
+			alpha := sum[3] / area
+			if alpha == 0 {
+				continue // fully transparent
+			}
+			for c := 0; c < 3; c++ {
+				dst.Pix[i+c] = uint8(math.Round(math.Min(255, sum[c]/area*255/alpha)))
+			}
+			dst.Pix[i+3] = uint8(math.Round(alpha))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,216 @@
+package be
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	. "be/internal/debug"
+	"be/lex"
+	"be/tok"
+)
+
+// Keyword arguments come before all other arguments of a form:
+//
+//	{code :lang go :file main.go \+...\+}
+//
+// The value of a keyword is the word following it, or the form following it
+// if the keyword ends the text: {image :title {em hover text} ...}.
+type keyword struct {
+	name string
+	pos tok.Position
+	value *Node
+}
+
+// parseKeywords consumes the keyword arguments at the start of the
+// arguments.
+// Keywords are only taken from the first line of a text, before any escape
+// or raw string, so that a raw string may start with a colon.
+func (a *Args) parseKeywords() error {
+	for a.next != nil && a.next.Type == TypeText {
+		node := a.next
+		text, toEnd := keywordText(node)
+		pos := node.Pos
+		consumed := 0 // words of the text
+		for {
+			trimmed := strings.TrimLeftFunc(text, tok.IsWhitespace)
+			name, ok := keywordName(trimmed)
+			if !ok {
+				break
+			}
+			pos = pos.Advance(text[:len(text)-len(trimmed)])
+			kw := &keyword{name: name, pos: pos}
+			if prev := a.keyword(name); prev != nil {
+				return fmt.Errorf("%s: %s: duplicate keyword argument: :%s, first given at: %s", pos, string(a.fun.Atom), name, prev.pos)
+			}
+			a.keywords = append(a.keywords, kw)
+			consumed++
+			text = trimmed[len(name)+1:]
+			pos = pos.Advance(trimmed[:len(name)+1])
+			trimmed = strings.TrimLeftFunc(text, tok.IsWhitespace)
+			if _, ok := keywordName(trimmed); ok {
+				return fmt.Errorf("%s: %s: missing value of keyword argument: :%s", kw.pos, string(a.fun.Atom), name)
+			}
+			if trimmed == "" {
+				// the value is the next argument
+				if !toEnd || node.Next == nil || node.Next.Type == TypeText {
+					return fmt.Errorf("%s: %s: missing value of keyword argument: :%s", kw.pos, string(a.fun.Atom), name)
+				}
+				kw.value = node.Next
+				a.next = node.Next.Next
+				text = ""
+				break
+			}
+			pos = pos.Advance(text[:len(text)-len(trimmed)])
+			end := strings.IndexFunc(trimmed, tok.IsWhitespace)
+			if end < 0 {
+				end = len(trimmed)
+			}
+			kw.value = &Node{
+				Type: TypeText,
+				Text: lex.Text(trimmed[:end]),
+				Pos: pos,
+				End: pos.Advance(trimmed[:end]),
+			}
+			consumed++
+			text = trimmed[end:]
+			pos = kw.value.End
+		}
+		if len(a.keywords) == 0 {
+			return nil
+		}
+		if a.next != node { // the text ended with a keyword taking a form
+			continue
+		}
+		// the rest of the line following the keywords is skipped, so that
+		// a raw string starting on it begins with the next line
+		rest := strings.TrimLeft(dropWords(string(node.Text), consumed), " \t")
+		rest = strings.TrimPrefix(rest, "\n")
+		pos = skipLine(pos)
+		if rest == "" {
+			a.next = node.Next
+			continue
+		}
+		a.next = &Node{
+			Next: node.Next,
+			Type: TypeText,
+			Text: lex.Text(rest),
+			Pos: pos,
+			End: node.End,
+		}
+		return nil
+	}
+	return nil
+}
+
+// keywordText returns the text of node that keywords are parsed from: its
+// source up to the end of the line or the first escape (which includes raw
+// strings), so keyword values are taken as written: {code :file ~/x} names
+// ~/x, without a non-breaking space. It reports whether the rest of the
+// text is empty, for a keyword at its end to take the following form.
+// If the source is not available, it is the cooked text.
+func keywordText(node *Node) (string, bool) {
+	var src []rune
+	if node.Pos.Source != nil {
+		src = node.Pos.Source.Text()
+	}
+	if node.Pos.Offset > node.End.Offset || node.End.Offset > len(src) {
+		return string(node.Text), true
+	}
+	raw := src[node.Pos.Offset:node.End.Offset]
+	end := slices.IndexFunc(raw, func(r rune) bool {
+		return r == tok.SymbolEscape || r == '\n'
+	})
+	if end < 0 {
+		end = len(raw)
+	}
+	text := string(raw[:end])
+	// the node may not be read from its position, like the body text of a
+	// macro
+	if !strings.HasPrefix(strings.Join(words(string(node.Text)), " "), strings.Join(words(cooked.Replace(text)), " ")) {
+		return string(node.Text), true
+	}
+	return text, strings.TrimLeftFunc(string(raw[end:]), tok.IsWhitespace) == ""
+}
+
+// cooked replaces the symbols the tokenizer replaces in texts.
+var cooked = strings.NewReplacer("~", "\u00a0", "...", "…")
+
+func words(s string) []string {
+	return strings.FieldsFunc(s, tok.IsWhitespace)
+}
+
+// dropWords returns s without its first n words.
+func dropWords(s string, n int) string {
+	for range n {
+		s = strings.TrimLeftFunc(s, tok.IsWhitespace)
+		end := strings.IndexFunc(s, tok.IsWhitespace)
+		if end < 0 {
+			return ""
+		}
+		s = s[end:]
+	}
+	return s
+}
+
+// skipLine returns the position following the spaces and the line break
+// at pos in its source, if any.
+func skipLine(pos tok.Position) tok.Position {
+	if pos.Source == nil {
+		return pos
+	}
+	src := pos.Source.Text()
+	for pos.Offset < len(src) && (src[pos.Offset] == ' ' || src[pos.Offset] == '\t') {
+		pos = pos.Advance(string(src[pos.Offset]))
+	}
+	if pos.Offset < len(src) && src[pos.Offset] == '\n' {
+		pos = pos.Advance("\n")
+	}
+	return pos
+}
+
+// keywordName returns the name of the keyword at the start of s, if it
+// starts with one.
+func keywordName(s string) (string, bool) {
+	if !strings.HasPrefix(s, ":") {
+		return "", false
+	}
+	end := strings.IndexFunc(s[1:], func(r rune) bool {
+		return !tok.IsAtomChar(r)
+	})
+	if end < 0 {
+		end = len(s) - 1
+	}
+	if end == 0 || (end+1 < len(s) && !tok.IsWhitespace(rune(s[end+1]))) {
+		return "", false
+	}
+	return s[1 : end+1], true
+}
+
+func (a *Args) keyword(name string) *keyword {
+	for _, kw := range a.keywords {
+		if kw.name == name {
+			return kw
+		}
+	}
+	return nil
+}
+
+// Keyword returns the value of the keyword argument :name.
+// If it is not given, the value is a text with the default of the keyword
+// in the signature, positioned at the form.
+func (a *Args) Keyword(name string) *Node {
+	if kw := a.keyword(name); kw != nil {
+		return kw.value
+	}
+	i := slices.IndexFunc(a.sig.Keywords, func(p Param) bool {
+		return p.Name == name
+	})
+	Assert(i >= 0, fmt.Sprintf("%s has no keyword :%s", a.sig.Name, name))
+	return &Node{
+		Type: TypeText,
+		Text: lex.Text(a.sig.Keywords[i].Default),
+		Pos: a.fun.Pos,
+		End: a.fun.End,
+	}
+}
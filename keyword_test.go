@@ -0,0 +1,79 @@
+package be
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"be/lex"
+	"be/tok"
+)
+
+func TestParseKeywords(t *testing.T) {
+	tests := []struct {
+		src string
+		keywords string // name=value@line:column, a form value is {name}
+		rest string // the text following the keywords
+		err string
+	}{
+		{`{code x}`, ``, `x`, ``},
+		{"{code :lang go :file main.go \\+\nx\n\\+}", `lang=go@1:13 file=main.go@1:22`, "x\n", ``},
+		{"{code  :lang \t go\n x}", `lang=go@1:16`, `x`, ``},
+		{`{code :file ~/.ssh/config x}`, `file=~/.ssh/config@1:13`, `x`, ``},
+		{`{code :lang {em go} x}`, `lang={em}`, `x`, ``},
+		{`{code :lang {em go} :file f x}`, `lang={em} file=f@1:27`, `x`, ``},
+		{`{code :lang go}`, `lang=go@1:13`, ``, ``},
+
+		// keywords are only taken from the first line, before a raw string
+		{"{code \\+\n:set number\n\\+}", ``, "\n:set number\n", ``},
+		{"{code \\+:lang go\\+}", ``, `:lang go`, ``},
+		{"{code :lang go \\+:file f\\+}", `lang=go@1:13`, `:file f`, ``},
+		{"{code :lang go\n:file f}", `lang=go@1:13`, `:file f`, ``},
+		{"{code :lang\n{em go}}", `lang={em}`, ``, ``},
+		{`{code a :lang go}`, ``, `a :lang go`, ``},
+
+		{`{code :lang go :lang c x}`, ``, ``, `test.be:1:16: code: duplicate keyword argument: :lang, first given at: test.be:1:7`},
+		{`{code :lang go :file f :lang c x}`, ``, ``, `test.be:1:24: code: duplicate keyword argument: :lang`},
+		{`{code :lang :file f x}`, ``, ``, `test.be:1:7: code: missing value of keyword argument: :lang`},
+		{`{code :lang}`, ``, ``, `test.be:1:7: code: missing value of keyword argument: :lang`},
+		{`{code :lang \+go\+}`, ``, ``, `test.be:1:7: code: missing value of keyword argument: :lang`},
+		{"{code :lang\ngo}", ``, ``, `test.be:1:7: code: missing value of keyword argument: :lang`},
+		{`{code :lang {em go}{em c}}`, `lang={em}`, ``, ``},
+	}
+	for _, test := range tests {
+		tokens, err := tok.NewSourceTokenizer("test.be", []rune(test.src), nil).Tokenize()
+		if err != nil {
+			t.Fatalf("%q: tokenize: %v", test.src, err)
+		}
+		root, err := lex.Lex(tokens)
+		if err != nil {
+			t.Fatalf("%q: lex: %v", test.src, err)
+		}
+		args := NewArgs(root.First.Next.Form.First)
+		err = args.parseKeywords()
+		if test.err != "" || err != nil {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%q: want: error %q, got: %v", test.src, test.err, err)
+			}
+			continue
+		}
+		var keywords []string
+		for _, kw := range args.keywords {
+			if kw.value.Type == TypeForm {
+				keywords = append(keywords, fmt.Sprintf("%s={%s}", kw.name, formName(kw.value)))
+			} else {
+				keywords = append(keywords, fmt.Sprintf("%s=%s@%d:%d", kw.name, string(kw.value.Text), kw.value.Pos.Line, kw.value.Pos.Column))
+			}
+		}
+		if got := strings.Join(keywords, " "); got != test.keywords {
+			t.Errorf("%q: want: keywords %q, got: %q", test.src, test.keywords, got)
+		}
+		var rest string
+		if next := args.Peek(); next != nil && next.Type == TypeText {
+			rest = string(next.Text)
+		}
+		if rest != test.rest {
+			t.Errorf("%q: want: rest %q, got: %q", test.src, test.rest, rest)
+		}
+	}
+}
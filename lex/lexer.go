@@ -1,7 +1,10 @@
 package lex
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+
 	"be/tok"
 )
 
@@ -19,6 +22,11 @@ type (
 		Atom Atom  // TypeAtom
 		Text Text  // TypeText
 		Form *Head // TypeForm
+		Pos, End tok.Position // [Pos, End) span of the node in the source
+		// Only set if the tokens were produced in lossless mode, see
+		// tok.Token.
+		Leading, Raw string
+		CloseLeading, CloseRaw string // TypeForm: the closing brace
 	}
 	Atom string
 	Text string
@@ -36,13 +44,25 @@ func (h *Head) Append(n *Node) {
 	h.Last = n
 }
 
-func Lex(tokens []tok.Token) *Head {
+// Lex builds the syntax tree from tokens.
+// Structural errors (unbalanced braces, forms not starting with an atom) are
+// all collected and returned together. The (possibly incomplete) tree is
+// returned regardless, but must not be evaluated if there are errors.
+func Lex(tokens []tok.Token) (*Head, error) {
 	root := &Head{}
 	root.Append(&Node{
 		Type: TypeAtom,
 		Atom: "root",
 	})
+	var errs []error
 	forms := []*Head{root}
+	nodes := []*Node{nil} // form node belonging to each head
+	appendTo := func(top *Head, n *Node) {
+		if top.First == nil && top != root && n.Type != TypeAtom {
+			errs = append(errs, newLexError(nodes[len(nodes)-1], fmt.Sprintf("form must start with an atom, got: %s", n.Type)))
+		}
+		top.Append(n)
+	}
 	for _, t := range tokens {
 		top := forms[len(forms)-1]
 		switch t.Type {
@@ -51,28 +71,118 @@ func Lex(tokens []tok.Token) *Head {
 			form := &Node{
 				Type: TypeForm,
 				Form: head,
+				Pos: t.Pos,
+				End: t.End,
+				Leading: t.Leading,
+				Raw: t.Raw,
 			}
-			top.Append(form)
+			appendTo(top, form)
 			forms = append(forms, head)
+			nodes = append(nodes, form)
 		case tok.TypeAtom:
 			atom := &Node{
 				Type: TypeAtom,
 				Atom: Atom(t.Text),
+				Pos: t.Pos,
+				End: t.End,
+				Leading: t.Leading,
+				Raw: t.Raw,
 			}
-			top.Append(atom)
+			appendTo(top, atom)
 		case tok.TypeText:
 			text := &Node{
 				Type: TypeText,
 				Text: Text(t.Text),
+				Pos: t.Pos,
+				End: t.End,
+				Leading: t.Leading,
+				Raw: t.Raw,
 			}
-			top.Append(text)
+			appendTo(top, text)
 		case tok.TypeFormEnd:
+			if len(forms) == 1 {
+				errs = append(errs, LexError{
+					Msg: "unmatched `}`, there is no open form to close",
+					Pos: t.Pos,
+					End: t.End,
+				})
+				continue
+			}
+			form := nodes[len(nodes)-1]
+			form.End = t.End
+			form.CloseLeading = t.Leading
+			form.CloseRaw = t.Raw
+			if top.First == nil {
+				errs = append(errs, newLexError(form, "empty form, expected an atom"))
+			}
 			forms = forms[:len(forms)-1]
+			nodes = nodes[:len(nodes)-1]
 		default:
-			panic("invalid token")
+			errs = append(errs, LexError{
+				Msg: fmt.Sprintf("invalid token: %s", t),
+				Pos: t.Pos,
+				End: t.End,
+			})
+		}
+	}
+	for i := len(nodes)-1; i > 0; i-- { // report innermost unclosed form first
+		form := nodes[i]
+		msg := "form opened here is never closed"
+		if first := form.Form.First; first != nil && first.Type == TypeAtom {
+			msg = fmt.Sprintf("form `%s` opened here is never closed", string(first.Atom))
 		}
+		errs = append(errs, newLexError(form, msg))
+	}
+	return root, errors.Join(errs...)
+}
+
+type LexError struct {
+	Msg string
+	Pos, End tok.Position
+}
+
+// newLexError reports an error at the opening brace of form.
+func newLexError(form *Node, msg string) LexError {
+	return LexError{
+		Msg: msg,
+		Pos: form.Pos,
+	}
+}
+
+func (e LexError) Error() string {
+	return tok.FormatDiagnostic(e.Pos, e.End, e.Msg)
+}
+
+// Source prints the tree as it was written, if it was lexed from tokens
+// produced in lossless mode.
+func (h *Head) Source() string {
+	b := &strings.Builder{}
+	h.writeSource(b)
+	return b.String()
+}
+
+func (h *Head) writeSource(b *strings.Builder) {
+	for n := h.First; n != nil; n = n.Next {
+		n.writeSource(b)
+	}
+}
+
+// Source prints the node (but not its siblings) as it was written, if it
+// was lexed from tokens produced in lossless mode.
+func (n *Node) Source() string {
+	b := &strings.Builder{}
+	n.writeSource(b)
+	return b.String()
+}
+
+func (n *Node) writeSource(b *strings.Builder) {
+	b.WriteString(n.Leading)
+	b.WriteString(n.Raw)
+	if n.Type == TypeForm {
+		n.Form.writeSource(b)
+		b.WriteString(n.CloseLeading)
+		b.WriteString(n.CloseRaw)
 	}
-	return root
 }
 
 func tabs(n int) (s string) {
@@ -0,0 +1,74 @@
+package be
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// listFun returns the form for (un)ordered lists.
+// Ordered lists may start with a number other than 1.
+func listFun(name string, ordered bool) beFun {
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		list := &List{
+			Ordered: ordered,
+			Start: 1,
+		}
+		if start := args.Peek(); ordered && start != nil && start.Type == TypeText {
+			args.Next()
+			text := strings.TrimSpace(string(start.Text))
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return fmt.Errorf("%s: %s: want: start number, got: %q", start.Pos, name, text)
+			}
+			list.Start = n
+		}
+		scopes.RegisterFun("item", func(blog *Blog, scopes *Scopes, args *Args) error {
+			item := &ListItem{}
+			list.Append(item)
+			return blog.applyAll(item, scopes, args)
+		})
+		for content := args.Next(); content != nil; content = args.Next() {
+			if formName(content) != "item" {
+				return fmt.Errorf("%s: %s: want: {item}, got: {%s}", content.Pos, name, formName(content))
+			}
+			if err := blog.Apply(list, scopes, content); err != nil {
+				return err
+			}
+		}
+		if len(list.Items) == 0 {
+			return fmt.Errorf("%s: %s: list without items", args.fun.Pos, name)
+		}
+		scopes.Parent().Append(list)
+		return nil
+	}
+}
+
+func deflistFun(blog *Blog, scopes *Scopes, args *Args) error {
+	list := &DefList{}
+	entry := func(term bool) beFun {
+		return func(blog *Blog, scopes *Scopes, args *Args) error {
+			if !term && len(list.Entries) == 0 {
+				return fmt.Errorf("%s: def: definition without term", args.fun.Pos)
+			}
+			e := &DefEntry{Term: term}
+			list.Append(e)
+			return blog.applyAll(e, scopes, args)
+		}
+	}
+	scopes.RegisterFun("term", entry(true))
+	scopes.RegisterFun("def", entry(false))
+	for content := args.Next(); content != nil; content = args.Next() {
+		if name := formName(content); name != "term" && name != "def" {
+			return fmt.Errorf("%s: deflist: want: {term} or {def}, got: {%s}", content.Pos, name)
+		}
+		if err := blog.Apply(list, scopes, content); err != nil {
+			return err
+		}
+	}
+	if len(list.Entries) == 0 {
+		return fmt.Errorf("%s: deflist: list without terms", args.fun.Pos)
+	}
+	scopes.Parent().Append(list)
+	return nil
+}
@@ -0,0 +1,152 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// The subset of the language server protocol implemented by the server.
+// @from: https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+type (
+	request struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID *json.RawMessage `json:"id,omitempty"` // nil for notifications
+		Method string `json:"method"`
+		Params json.RawMessage `json:"params,omitempty"`
+	}
+	response struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID *json.RawMessage `json:"id"`
+		Result any `json:"result"`
+		Error *responseError `json:"error,omitempty"`
+	}
+	responseError struct {
+		Code int `json:"code"`
+		Message string `json:"message"`
+	}
+	notification struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method string `json:"method"`
+		Params any `json:"params"`
+	}
+)
+
+const (
+	codeParseError = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams = -32602
+)
+
+type (
+	Position struct {
+		Line int `json:"line"`
+		Character int `json:"character"` // in UTF-16 code units
+	}
+	Range struct {
+		Start Position `json:"start"`
+		End Position `json:"end"`
+	}
+	Location struct {
+		URI string `json:"uri"`
+		Range Range `json:"range"`
+	}
+	TextDocumentIdentifier struct {
+		URI string `json:"uri"`
+	}
+	TextDocumentItem struct {
+		URI string `json:"uri"`
+		LanguageID string `json:"languageId"`
+		Version int `json:"version"`
+		Text string `json:"text"`
+	}
+	TextDocumentPositionParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		Position Position `json:"position"`
+	}
+	DidOpenTextDocumentParams struct {
+		TextDocument TextDocumentItem `json:"textDocument"`
+	}
+	DidChangeTextDocumentParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"` // full sync only
+		} `json:"contentChanges"`
+	}
+	DidCloseTextDocumentParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+	DocumentSymbolParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+	Diagnostic struct {
+		Range Range `json:"range"`
+		Severity int `json:"severity"`
+		Source string `json:"source"`
+		Message string `json:"message"`
+	}
+	PublishDiagnosticsParams struct {
+		URI string `json:"uri"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	CompletionItem struct {
+		Label string `json:"label"`
+		Kind int `json:"kind"`
+		Detail string `json:"detail,omitempty"`
+		Documentation string `json:"documentation,omitempty"`
+	}
+	MarkupContent struct {
+		Kind string `json:"kind"`
+		Value string `json:"value"`
+	}
+	Hover struct {
+		Contents MarkupContent `json:"contents"`
+		Range *Range `json:"range,omitempty"`
+	}
+	DocumentSymbol struct {
+		Name string `json:"name"`
+		Detail string `json:"detail,omitempty"`
+		Kind int `json:"kind"`
+		Range Range `json:"range"`
+		SelectionRange Range `json:"selectionRange"`
+		Children []DocumentSymbol `json:"children,omitempty"`
+	}
+)
+
+const (
+	severityError = 1
+	severityWarning = 2
+	completionKindFunction = 3
+	symbolKindNamespace = 3
+	syncFull = 1
+)
+
+func readMessage(r *bufio.Reader) (req request, err error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return req, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return req, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return req, err
+	}
+	err = json.Unmarshal(body, &req)
+	return req, err
+}
+
+func writeMessage(w io.Writer, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,577 @@
+// Package lsp implements a language server for the be markup language.
+//
+// Supported are diagnostics, completion of the forms in scope, hover
+// documentation of forms, go-to-definition for references to section anchors
+// (`#section-id`) and macros, and document symbols for sections.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"be"
+	"be/lex"
+	"be/tok"
+)
+
+type (
+	Server struct {
+		in *bufio.Reader
+		out io.Writer
+		docs map[string]*document
+		shutdown bool
+	}
+	document struct {
+		uri string
+		text []rune
+		lines []int // rune offset at which each line starts
+		root *lex.Head
+		diagnostics []Diagnostic
+		anchors map[string]Range // ids of the evaluated blog that can be linked to
+		macros map[string]macro
+	}
+	macro struct {
+		usage string
+		name Range
+	}
+)
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in: bufio.NewReader(in),
+		out: out,
+		docs: map[string]*document{},
+	}
+}
+
+// Serve handles requests until the client asks the server to exit.
+func (s *Server) Serve() error {
+	for {
+		req, err := readMessage(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				if err := s.respond(nil, nil, &responseError{codeParseError, err.Error()}); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(req)
+		if req.ID == nil { // notifications are not answered
+			continue
+		}
+		if err := s.respond(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) respond(id *json.RawMessage, result any, rerr *responseError) error {
+	return writeMessage(s.out, response{
+		JSONRPC: "2.0",
+		ID: id,
+		Result: result,
+		Error: rerr,
+	})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{
+		JSONRPC: "2.0",
+		Method: method,
+		Params: params,
+	})
+}
+
+func (s *Server) handle(req request) (result any, rerr *responseError) {
+	decode := func(params any) bool {
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			rerr = &responseError{codeInvalidParams, err.Error()}
+			return false
+		}
+		return true
+	}
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": syncFull,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{string(tok.SymbolFormStart)},
+				},
+				"hoverProvider": true,
+				"definitionProvider": true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]any{
+				"name": "be",
+			},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if decode(&params) {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+		return nil, rerr
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if decode(&params) && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, rerr
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if decode(&params) {
+			delete(s.docs, params.TextDocument.URI)
+			s.publish(params.TextDocument.URI, []Diagnostic{})
+		}
+		return nil, rerr
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if !decode(&params) {
+			return nil, rerr
+		}
+		if doc, ok := s.docs[params.TextDocument.URI]; ok {
+			return doc.complete(doc.offset(params.Position)), nil
+		}
+		return []CompletionItem{}, nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if !decode(&params) {
+			return nil, rerr
+		}
+		if doc, ok := s.docs[params.TextDocument.URI]; ok {
+			if hover := doc.hover(doc.offset(params.Position)); hover != nil {
+				return hover, nil
+			}
+		}
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if !decode(&params) {
+			return nil, rerr
+		}
+		if doc, ok := s.docs[params.TextDocument.URI]; ok {
+			if loc := doc.definition(doc.offset(params.Position)); loc != nil {
+				return loc, nil
+			}
+		}
+		return nil, nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if !decode(&params) {
+			return nil, rerr
+		}
+		if doc, ok := s.docs[params.TextDocument.URI]; ok {
+			return doc.symbols(doc.root), nil
+		}
+		return []DocumentSymbol{}, nil
+	}
+	return nil, &responseError{codeMethodNotFound, fmt.Sprintf("method not supported: %s", req.Method)}
+}
+
+func (s *Server) update(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	s.publish(uri, doc.diagnostics)
+}
+
+func (s *Server) publish(uri string, diagnostics []Diagnostic) {
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI: uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func newDocument(uri, text string) *document {
+	doc := &document{
+		uri: uri,
+		text: []rune(text),
+		lines: []int{0},
+		diagnostics: []Diagnostic{},
+		anchors: map[string]Range{},
+		macros: map[string]macro{},
+	}
+	for i, r := range doc.text {
+		if r == '\n' {
+			doc.lines = append(doc.lines, i+1)
+		}
+	}
+	// named by path, so that includes are resolved relative to it
+	tokenizer := tok.NewSourceTokenizer(uriToPath(uri), doc.text, nil)
+	tokenizer.Recover = true
+	tokenizer.Lossless = true
+	tokens, err := tokenizer.Tokenize()
+	doc.report(err)
+	doc.root, err = lex.Lex(tokens)
+	doc.report(err)
+	if len(doc.diagnostics) == 0 {
+		doc.evaluate()
+	}
+	doc.collectMacros(doc.root)
+	return doc
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// evaluate reports errors that only show when evaluating the document, and
+// collects the anchors of the blog.
+// The site configuration is read from site.be next to the document, if it
+// exists, and root-relative paths are resolved against that directory.
+// Nothing is written while evaluating, see Scopes.DryRun.
+func (d *document) evaluate() {
+	defer func() {
+		if r := recover(); r != nil {
+			d.diagnostics = append(d.diagnostics, Diagnostic{
+				Severity: severityError,
+				Source: "be",
+				Message: fmt.Sprintf("evaluation failed: %v", r),
+			})
+		}
+	}()
+	sources := tok.NewSources()
+	path := uriToPath(d.uri)
+	site := be.DefaultSite
+	site.Root = filepath.Dir(path)
+	if siteFile := filepath.Join(filepath.Dir(path), "site.be"); fileExists(siteFile) {
+		var err error
+		if site, err = be.LoadSite(siteFile, sources); err != nil {
+			// in another file, report it at the start of the document
+			d.diagnostics = append(d.diagnostics, Diagnostic{
+				Severity: severityError,
+				Source: "be",
+				Message: fmt.Sprintf("error loading site configuration: %v", err),
+			})
+			site = be.DefaultSite
+			site.Root = filepath.Dir(path)
+		}
+	}
+	blog := be.NewBlog(site)
+	scopes := be.InitScopes(blog)
+	scopes.Sources = sources
+	scopes.Diagnostics = &be.Diagnostics{}
+	scopes.DryRun = true
+	d.report(blog.Eval(scopes, d.root.First))
+	for _, diag := range scopes.Diagnostics.List {
+		d.report(diag)
+	}
+	for id, anchor := range blog.Anchors {
+		if anchor.Pos.FileName() == path {
+			d.anchors[id] = d.span(anchor.Pos, anchor.End)
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func (d *document) report(err error) {
+	if err == nil {
+		return
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			d.report(err)
+		}
+		return
+	}
+	diag := Diagnostic{
+		Severity: severityError,
+		Source: "be",
+		Message: err.Error(),
+	}
+	var (
+		beDiag be.Diagnostic
+		inclErr be.IncludeError
+		evalErr be.EvalError
+		tokErr tok.TokenError
+		lexErr lex.LexError
+	)
+	if errors.As(err, &beDiag) {
+		diag.Message = beDiag.Err.Error()
+		if beDiag.Severity == be.SeverityWarning {
+			diag.Severity = severityWarning
+		}
+	}
+	if errors.As(err, &inclErr) {
+		// the error is in another file, report it at the include
+		site := inclErr.Chain[len(inclErr.Chain)-1]
+		diag.Range = d.span(site, site)
+	} else if errors.As(err, &evalErr) {
+		// at the name of the form in which it occurred
+		frame := evalErr.Innermost()
+		if path := uriToPath(d.uri); frame.Pos.FileName() != path {
+			// in another file, report it at the include
+			for _, f := range evalErr.Forms {
+				if f.Pos.FileName() == path {
+					frame = f
+				}
+			}
+		}
+		diag.Range = d.span(frame.Pos, frame.End)
+		if trace := evalErr.Trace(); trace != "" {
+			diag.Message += "\nin " + trace
+		}
+	} else if errors.As(err, &tokErr) {
+		diag.Range = d.span(tokErr.Pos, tokErr.End)
+		diag.Message = tokErr.Msg
+	} else if errors.As(err, &lexErr) {
+		diag.Range = d.span(lexErr.Pos, lexErr.End)
+		diag.Message = lexErr.Msg
+	}
+	d.diagnostics = append(d.diagnostics, diag)
+}
+
+// position converts a rune offset into a protocol position.
+func (d *document) position(offset int) Position {
+	offset = max(0, min(offset, len(d.text)))
+	line := 0
+	for line+1 < len(d.lines) && d.lines[line+1] <= offset {
+		line++
+	}
+	return Position{
+		Line: line,
+		Character: len(utf16.Encode(d.text[d.lines[line]:offset])),
+	}
+}
+
+// offset converts a protocol position into a rune offset.
+func (d *document) offset(pos Position) int {
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset, units := d.lines[max(pos.Line, 0)], 0
+	for offset < len(d.text) && d.text[offset] != '\n' && units < pos.Character {
+		units += len(utf16.Encode([]rune{d.text[offset]}))
+		offset++
+	}
+	return offset
+}
+
+func (d *document) span(start, end tok.Position) Range {
+	if !end.IsValid() || end.Offset <= start.Offset {
+		end = start
+		end.Offset++
+	}
+	return Range{d.position(start.Offset), d.position(end.Offset)}
+}
+
+func (d *document) nodeRange(n *lex.Node) Range {
+	return d.span(n.Pos, n.End)
+}
+
+func isUnclosed(form *lex.Node) bool {
+	return form.CloseRaw == ""
+}
+
+func atomOf(form *lex.Node) *lex.Node {
+	if first := form.Form.First; first != nil && first.Type == lex.TypeAtom {
+		return first
+	}
+	return nil
+}
+
+// enclosing returns the forms containing offset, outermost first.
+func (d *document) enclosing(offset int) (forms []*lex.Node) {
+	head := d.root
+outer:
+	for head != nil {
+		for n := head.First; n != nil; n = n.Next {
+			if n.Type == lex.TypeForm && n.Raw != "" && n.Pos.Offset < offset && (isUnclosed(n) || offset < n.End.Offset) {
+				forms = append(forms, n)
+				head = n.Form
+				continue outer
+			}
+		}
+		break
+	}
+	return forms
+}
+
+// atomAt returns the atom (form name) at offset, or nil.
+func (d *document) atomAt(offset int) *lex.Node {
+	forms := d.enclosing(offset)
+	if len(forms) == 0 {
+		return nil
+	}
+	if atom := atomOf(forms[len(forms)-1]); atom != nil && atom.Pos.Offset <= offset && offset <= atom.End.Offset {
+		return atom
+	}
+	return nil
+}
+
+func (d *document) complete(offset int) []CompletionItem {
+	forms := d.enclosing(offset)
+	if len(forms) > 0 {
+		innermost := forms[len(forms)-1]
+		if atom := atomOf(innermost); atom == nil || d.atomAt(offset) == atom {
+			forms = forms[:len(forms)-1] // the form whose name is being completed
+		}
+	}
+	var enclosing []string
+	for _, form := range forms {
+		if atom := atomOf(form); atom != nil {
+			enclosing = append(enclosing, string(atom.Atom))
+		}
+	}
+	items := []CompletionItem{}
+	for _, doc := range be.FormsInScope(enclosing) {
+		items = append(items, CompletionItem{
+			Label: doc.Name,
+			Kind: completionKindFunction,
+			Detail: doc.Usage,
+			Documentation: doc.Doc,
+		})
+	}
+	for name, m := range d.macros {
+		items = append(items, CompletionItem{
+			Label: name,
+			Kind: completionKindFunction,
+			Detail: m.usage,
+			Documentation: "Macro defined in this document.",
+		})
+	}
+	return items
+}
+
+func (d *document) hover(offset int) *Hover {
+	atom := d.atomAt(offset)
+	if atom == nil {
+		return nil
+	}
+	doc, ok := be.LookupForm(string(atom.Atom))
+	if m, isMacro := d.macros[string(atom.Atom)]; isMacro {
+		doc, ok = be.Signature{Usage: m.usage, Doc: "Macro defined in this document."}, true
+	}
+	if !ok {
+		return nil
+	}
+	value := fmt.Sprintf("```\n%s\n```\n%s", doc.Usage, doc.Doc)
+	if len(doc.Keywords) > 0 {
+		value += "\n"
+	}
+	for _, kw := range doc.Keywords {
+		value += fmt.Sprintf("\n- `:%s` %s", kw.Name, kw.Doc)
+	}
+	r := d.nodeRange(atom)
+	return &Hover{
+		Contents: MarkupContent{
+			Kind: "markdown",
+			Value: value,
+		},
+		Range: &r,
+	}
+}
+
+// definition resolves references to section anchors (`#section-id`) and
+// macros.
+func (d *document) definition(offset int) *Location {
+	if atom := d.atomAt(offset); atom != nil {
+		if m, ok := d.macros[string(atom.Atom)]; ok {
+			return &Location{URI: d.uri, Range: m.name}
+		}
+		return nil
+	}
+	start, end := offset, offset
+	for start > 0 && isRefChar(d.text[start-1]) {
+		start--
+	}
+	for end < len(d.text) && isRefChar(d.text[end]) {
+		end++
+	}
+	ref := string(d.text[start:end])
+	if len(ref) < 2 || ref[0] != '#' {
+		return nil
+	}
+	if r, ok := d.anchors[ref[1:]]; ok {
+		return &Location{URI: d.uri, Range: r}
+	}
+	return nil
+}
+
+func isRefChar(r rune) bool {
+	return r == '#' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
+
+// collectMacros finds all macro definitions, regardless of their scope.
+func (d *document) collectMacros(head *lex.Head) {
+	for n := head.First; n != nil; n = n.Next {
+		if n.Type != lex.TypeForm {
+			continue
+		}
+		if atom := atomOf(n); atom != nil && atom.Atom == "define" && atom.Next != nil && atom.Next.Type == lex.TypeText {
+			fields := strings.Fields(string(atom.Next.Text))
+			if len(fields) == 0 {
+				continue
+			}
+			usage := []string{fields[0]}
+			if params := atom.Next.Next; params != nil && params.Type == lex.TypeForm {
+				if first := atomOf(params); first != nil && first.Atom == "params" && first.Next != nil && first.Next.Type == lex.TypeText {
+					usage = append(usage, strings.Fields(string(first.Next.Text))...)
+				}
+			}
+			d.macros[fields[0]] = macro{
+				usage: "{" + strings.Join(usage, " ") + "}",
+				name: d.nodeRange(atom.Next),
+			}
+		}
+		d.collectMacros(n.Form)
+	}
+}
+
+// symbols lists sections and subsections as a tree.
+func (d *document) symbols(head *lex.Head) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for n := head.First; n != nil; n = n.Next {
+		if n.Type != lex.TypeForm {
+			continue
+		}
+		atom := atomOf(n)
+		if atom == nil || (atom.Atom != "section" && atom.Atom != "subsection") || atom.Next == nil || atom.Next.Type != lex.TypeText {
+			symbols = append(symbols, d.symbols(n.Form)...)
+			continue
+		}
+		heading := atom.Next
+		symbols = append(symbols, DocumentSymbol{
+			Name: string(heading.Text),
+			Detail: string(atom.Atom),
+			Kind: symbolKindNamespace,
+			Range: d.nodeRange(n),
+			SelectionRange: d.nodeRange(heading),
+			Children: d.symbols(n.Form),
+		})
+	}
+	return symbols
+}
@@ -0,0 +1,109 @@
+package be
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"be/tok"
+)
+
+// MaxMacroDepth limits nested macro expansions, so that (accidentally)
+// recursive macros result in an error instead of a stack overflow.
+const MaxMacroDepth = 100
+
+// MacroDepthError is returned as is through all the expansions, instead of
+// wrapping it once per level.
+type MacroDepthError struct {
+	Macro string
+	Pos tok.Position
+}
+
+func (e MacroDepthError) Error() string {
+	return fmt.Sprintf("%s: %s: macro expansion too deep (limit %d), is it recursive?", e.Pos, e.Macro, MaxMacroDepth)
+}
+
+// Macro is a user defined form.
+//
+//	{define warning {params text}
+//		{paragraph {em Warning:} {text}}}
+//
+// Within the body, each parameter is a form without arguments that expands
+// to the argument passed for it.
+type Macro struct {
+	Name string
+	Params []string
+	Body []*Node
+}
+
+// parseParams returns the names declared by {params a b...}.
+// The params form is not evaluated, it is only valid within define.
+func parseParams(params *Node) (names []string, err error) {
+	args := NewArgs(params.Form.First)
+	if err := signatures["params"].Check(args); err != nil {
+		return nil, err
+	}
+	for list := args.Next(); list != nil; list = args.Next() {
+		for _, name := range strings.Fields(string(list.Text)) {
+			if slices.Contains(names, name) {
+				return nil, fmt.Errorf("%s: params: duplicate parameter: %s", list.Pos, name)
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// signature returns the signature calls of the macro are checked against,
+// each parameter takes one argument.
+func (m *Macro) signature() Signature {
+	sig := Signature{Name: m.Name}
+	for _, param := range m.Params {
+		sig.Params = append(sig.Params, Param{Name: param, Type: TypeAny})
+	}
+	return sig
+}
+
+// fun returns the form that expands the macro.
+// The body is evaluated in the scopes the macro was defined in (lexical
+// scoping), while arguments are evaluated in the scopes of the caller.
+func (m *Macro) fun(definition *Scopes) beFun {
+	// Clone, the scopes above the definition will be popped and replaced.
+	// The funs maps are shared, so that forms defined after the macro are
+	// visible to it, too.
+	lexical := slices.Clone(definition.scopes[:len(definition.scopes)-1])
+	sig := m.signature()
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		if scopes.depth >= MaxMacroDepth {
+			return MacroDepthError{m.Name, args.fun.Pos}
+		}
+		if err := sig.Check(args); err != nil {
+			return err
+		}
+		local := NewScope(scopes.Parent())
+		for _, param := range m.Params {
+			arg := args.Next()
+			paramSig := Signature{Name: param}
+			local.funs[param] = func(blog *Blog, inner *Scopes, paramArgs *Args) error {
+				if err := paramSig.Check(paramArgs); err != nil {
+					return err
+				}
+				return blog.Apply(inner.Parent(), scopes, arg)
+			}
+		}
+		expansion := &Scopes{
+			scopes: append(slices.Clip(lexical), local),
+			depth: scopes.depth + 1,
+			includes: slices.Clip(scopes.includes),
+			frames: slices.Clip(scopes.frames),
+			Sources: scopes.Sources,
+			Diagnostics: scopes.Diagnostics,
+		}
+		for _, content := range m.Body {
+			if err := blog.Apply(scopes.Parent(), expansion, content); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,195 @@
+package be
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"be/tok"
+)
+
+type (
+	// Site is the configuration shared by all blog posts.
+	// It is written in the markup itself, using the site form:
+	//
+	//	{site
+	//		{blog-name save-lisp-and-die}
+	//		{base-url https://blog.vanloo.ch}
+	//		{author {name cvl}}
+	//		{nav-link home /index.html}
+	//	}
+	//
+	// A post can use the site form, too, to override the configuration for
+	// itself only.
+	Site struct {
+		Name string
+		BaseURL string
+		// https://en.wikipedia.org/wiki/List_of_ISO_639_language_codes
+		Language string
+		Author Author
+		Nav []NavLink
+		OutputDir string
+		// Root is the directory root-relative paths (such as /public/img.png)
+		// are resolved against, usually the directory of the site
+		// configuration. It is the working directory if empty.
+		Root string
+		WordsPerMinute int // used to estimate the reading time
+		// Images wider than any of the ImageWidths are downscaled to them,
+		// and stored in ImageDir (relative to the site root).
+		ImageWidths []int
+		ImageDir string
+		// Sidenotes are rendered as SidenotesInline or SidenotesAsFootnotes
+		// (for outputs that cannot show them in the margin).
+		Sidenotes string
+	}
+	NavLink struct {
+		Label string
+		URL string
+	}
+)
+
+var DefaultSite = Site{
+	Name: "save-lisp-and-die",
+	Language: "en",
+	Author: Author{
+		Name: "cvl",
+	},
+	Nav: []NavLink{
+		{"home", "/index.html"},
+		{"about", "/about.html"},
+		{"rss", "/rss.xml"},
+	},
+	OutputDir: ".",
+	WordsPerMinute: 200,
+	ImageDir: "public/img",
+	Sidenotes: SidenotesInline,
+}
+
+// NewBlog returns a blog post with the defaults of site applied.
+func NewBlog(site Site) *Blog {
+	site.Nav = append([]NavLink(nil), site.Nav...)
+	site.ImageWidths = append([]int(nil), site.ImageWidths...)
+	return &Blog{
+		Site: site,
+		Author: site.Author,
+		Meta: Meta{
+			Language: site.Language,
+		},
+	}
+}
+
+// LoadSite reads the site configuration from the file at path, starting from
+// the DefaultSite. The site root is the directory of the file.
+func LoadSite(path string, sources *tok.Sources) (Site, error) {
+	blog := NewBlog(DefaultSite)
+	blog.Site.Root = filepath.Dir(path)
+	scopes := InitScopes(blog)
+	scopes.Sources = sources
+	scopes.RegisterFun("eof", func(blog *Blog, scopes *Scopes, args *Args) error {
+		return nil // not a post
+	})
+	root, err := scopes.parse(path)
+	if err != nil {
+		return Site{}, err
+	}
+	if err := blog.Eval(scopes, root.First); err != nil {
+		return Site{}, err
+	}
+	return blog.Site, nil
+}
+
+// OutputPath returns where the post generated from the source file is
+// written to.
+func (s Site) OutputPath(source string) string {
+	name := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	if name == "" || strings.HasPrefix(name, "<") {
+		name = "out"
+	}
+	return filepath.Join(s.OutputDir, name+".html")
+}
+
+func siteText(set func(blog *Blog, text string)) beFun {
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		set(blog, strings.TrimSpace(string(args.Next().Text)))
+		return nil
+	}
+}
+
+func siteFun(blog *Blog, scopes *Scopes, args *Args) error {
+	author, err := scopes.Resolve("author")
+	if err != nil {
+		return fmt.Errorf("%s: site: %w", args.fun.Pos, err)
+	}
+	scopes.RegisterFun("author", func(blog *Blog, scopes *Scopes, args *Args) error {
+		if err := author(blog, scopes, args); err != nil {
+			return err
+		}
+		blog.Site.Author = blog.Author
+		return nil
+	})
+	scopes.RegisterFun("blog-name", siteText(func(blog *Blog, text string) {
+		blog.Site.Name = text
+	}))
+	scopes.RegisterFun("base-url", siteText(func(blog *Blog, text string) {
+		blog.Site.BaseURL = strings.TrimSuffix(text, "/")
+	}))
+	scopes.RegisterFun("language", siteText(func(blog *Blog, text string) {
+		blog.Site.Language = text
+		blog.Meta.Language = text
+	}))
+	scopes.RegisterFun("output-dir", siteText(func(blog *Blog, text string) {
+		blog.Site.OutputDir = text
+	}))
+	scopes.RegisterFun("words-per-minute", func(blog *Blog, scopes *Scopes, args *Args) error {
+		wpm := args.Next()
+		n, err := strconv.Atoi(strings.TrimSpace(string(wpm.Text)))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s: words-per-minute: want: positive number, got: %q", wpm.Pos, string(wpm.Text))
+		}
+		blog.Site.WordsPerMinute = n
+		return nil
+	})
+	scopes.RegisterFun("image-widths", func(blog *Blog, scopes *Scopes, args *Args) error {
+		list := args.Next()
+		var widths []int
+		for _, field := range strings.Fields(string(list.Text)) {
+			w, err := strconv.Atoi(field)
+			if err != nil || w <= 0 {
+				return fmt.Errorf("%s: image-widths: want: positive numbers, got: %q", list.Pos, field)
+			}
+			widths = append(widths, w)
+		}
+		blog.Site.ImageWidths = widths
+		return nil
+	})
+	scopes.RegisterFun("image-dir", siteText(func(blog *Blog, text string) {
+		blog.Site.ImageDir = text
+	}))
+	scopes.RegisterFun("sidenotes", func(blog *Blog, scopes *Scopes, args *Args) error {
+		mode := args.Next()
+		text := strings.TrimSpace(string(mode.Text))
+		if text != SidenotesInline && text != SidenotesAsFootnotes {
+			return fmt.Errorf("%s: sidenotes: want: %s or %s, got: %q", mode.Pos, SidenotesInline, SidenotesAsFootnotes, text)
+		}
+		blog.Site.Sidenotes = text
+		return nil
+	})
+	nav := []NavLink{}
+	scopes.RegisterFun("nav-link", func(blog *Blog, scopes *Scopes, args *Args) error {
+		link := args.Next()
+		fields := strings.Fields(string(link.Text))
+		if len(fields) != 2 {
+			return fmt.Errorf("%s: nav-link: want: label url, got: %q", link.Pos, string(link.Text))
+		}
+		nav = append(nav, NavLink{fields[0], fields[1]})
+		return nil
+	})
+	if err := blog.applyAll(scopes.Parent(), scopes, args); err != nil {
+		return err
+	}
+	if len(nav) > 0 { // replaces the nav links, instead of adding to them
+		blog.Site.Nav = nav
+	}
+	return nil
+}
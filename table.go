@@ -0,0 +1,154 @@
+package be
+
+import (
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tableFun returns the form for tables.
+//
+//	{table
+//		{align left right}
+//		{caption Prices}
+//		{header Device \\ Price}
+//		{row reMarkable 2 \\ {em 399}}
+//		{row {span 2 sold out}}
+//	}
+//
+// Every argument of a row is a cell, {cell ...} and {span columns ...} are
+// cells with more than one argument.
+// With csv, the content is a raw string of comma separated values instead,
+// whose first record is the header.
+func tableFun(name string, csv bool) beFun {
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		blog.tables++
+		id := blog.anchor(blog.UniqueID(fmt.Sprintf("table-%d", blog.tables)), args.fun)
+		table := NewTable(id, blog.tables)
+		scopes.RegisterFun("caption", captionFun(name, &table.Caption))
+		scopes.RegisterFun("align", func(blog *Blog, scopes *Scopes, args *Args) error {
+			list := args.Next()
+			for _, align := range strings.Fields(string(list.Text)) {
+				if align != "left" && align != "right" && align != "center" {
+					return fmt.Errorf("%s: align: want: left, right or center, got: %s", list.Pos, align)
+				}
+				table.Align = append(table.Align, align)
+			}
+			return nil
+		})
+		children := []string{"align", "caption"}
+		if !csv {
+			scopes.RegisterFun("header", rowFun("header", table, true))
+			scopes.RegisterFun("row", rowFun("row", table, false))
+			children = append(children, "header", "row")
+		}
+		for content := args.Next(); content != nil; content = args.Next() {
+			if content.Type == TypeText {
+				if !csv {
+					return fmt.Errorf("%s: %s: text outside of a row", content.Pos, name)
+				}
+				if err := table.parseCSV(string(content.Text)); err != nil {
+					return fmt.Errorf("%s: %s: %w", content.Pos, name, err)
+				}
+				continue
+			}
+			if !slices.Contains(children, formName(content)) {
+				return fmt.Errorf("%s: %s: want: {%s}, got: {%s}", content.Pos, name, strings.Join(children, "}, {"), formName(content))
+			}
+			if err := blog.Apply(table, scopes, content); err != nil {
+				return err
+			}
+		}
+		if len(table.Head)+len(table.Body) == 0 {
+			return fmt.Errorf("%s: %s: table without rows", args.fun.Pos, name)
+		}
+		table.align()
+		scopes.Parent().Append(table)
+		return nil
+	}
+}
+
+func rowFun(name string, table *Table, header bool) beFun {
+	return func(blog *Blog, scopes *Scopes, args *Args) error {
+		row := &TableRow{Header: header}
+		cellFun := func(name string, span bool) beFun {
+			return func(blog *Blog, scopes *Scopes, args *Args) error {
+				cell := &TableCell{Header: header, Span: 1}
+				if span {
+					text := args.Next()
+					// the span may be followed by the cell's text
+					spanText, rest, _ := strings.Cut(strings.TrimSpace(string(text.Text)), " ")
+					var err error
+					cell.Span, err = strconv.Atoi(spanText)
+					if err != nil || cell.Span < 1 {
+						return fmt.Errorf("%s: %s: want: number of columns, got: %q", text.Pos, name, spanText)
+					}
+					if rest = strings.TrimSpace(rest); rest != "" {
+						cell.Append(Text(rest))
+					}
+				}
+				row.Append(cell)
+				return blog.applyAll(cell, scopes, args)
+			}
+		}
+		scopes.RegisterFun("cell", cellFun("cell", false))
+		scopes.RegisterFun("span", cellFun("span", true))
+		for content := args.Next(); content != nil; content = args.Next() {
+			var err error
+			if name := formName(content); name == "cell" || name == "span" {
+				err = blog.Apply(row, scopes, content)
+			} else {
+				cell := &TableCell{Header: header, Span: 1}
+				row.Append(cell)
+				if content.Type == TypeText {
+					cell.Append(Text(strings.TrimSpace(string(content.Text))))
+				} else {
+					err = blog.Apply(cell, scopes, content)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		table.Append(row)
+		return nil
+	}
+}
+
+// parseCSV adds the records of text to the table, the first one is the
+// header.
+func (t *Table) parseCSV(text string) error {
+	r := csv.NewReader(strings.NewReader(strings.TrimSpace(text)))
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		row := &TableRow{Header: i == 0}
+		for _, field := range record {
+			cell := &TableCell{Header: row.Header, Span: 1}
+			cell.Append(Text(field))
+			row.Append(cell)
+		}
+		t.Append(row)
+	}
+	return nil
+}
+
+// align sets the alignment of every cell to the one of its column.
+func (t *Table) align() {
+	for _, rows := range [][]*TableRow{t.Head, t.Body} {
+		for _, row := range rows {
+			column := 0
+			for _, cell := range row.Cells {
+				if column < len(t.Align) {
+					cell.Align = t.Align[column]
+				}
+				column += cell.Span
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package tok
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type (
+	// Source is a loaded source file.
+	Source struct {
+		Name string
+		text []rune
+		lines []int // rune offset at which each line starts
+	}
+	// Sources is a registry of all loaded source files, so that positions
+	// from any of them can be traced back to the source text.
+	Sources struct {
+		files map[string]*Source
+	}
+)
+
+func NewSource(name string, text []rune) *Source {
+	src := &Source{
+		Name: name,
+		text: text,
+		lines: []int{0},
+	}
+	for i, r := range text {
+		if r == '\n' {
+			src.lines = append(src.lines, i+1)
+		}
+	}
+	return src
+}
+
+func (s *Source) Text() []rune {
+	return s.text
+}
+
+// Line returns the text of the 1-based line n, without the line ending.
+func (s *Source) Line(n int) (string, bool) {
+	if s == nil || n < 1 || n > len(s.lines) {
+		return "", false
+	}
+	start, end := s.lines[n-1], len(s.text)
+	if n < len(s.lines) {
+		end = s.lines[n] - 1 // exclude \n
+	}
+	return strings.TrimSuffix(string(s.text[start:end]), "\r"), true
+}
+
+func NewSources() *Sources {
+	return &Sources{
+		files: map[string]*Source{},
+	}
+}
+
+// Add registers text under name, replacing any source previously loaded
+// with the same name.
+func (s *Sources) Add(name string, text []rune) *Source {
+	src := NewSource(name, text)
+	s.files[name] = src
+	return src
+}
+
+// Load reads the file at path and registers it.
+func (s *Sources) Load(path string) (*Source, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.Add(path, []rune(string(bs))), nil
+}
+
+func (s *Sources) Lookup(name string) (*Source, bool) {
+	src, ok := s.files[name]
+	return src, ok
+}
+
+// Names returns the names of all loaded sources in lexical order.
+func (s *Sources) Names() (names []string) {
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatDiagnostic renders msg in the style of a compiler diagnostic:
+//
+//	file:line:col: msg
+//	offending source line
+//	     ^~~~
+//
+// The source line is only shown if pos knows its source.
+// The underline spans up to end, if end is on the same line.
+func FormatDiagnostic(pos, end Position, msg string) string {
+	diag := fmt.Sprintf("%s: %s", pos, msg)
+	line, ok := pos.Source.Line(pos.Line)
+	if !ok {
+		return diag
+	}
+	indent := ""
+	for i, r := range []rune(line) {
+		if i >= pos.Column-1 {
+			break
+		}
+		if r == '\t' {
+			indent += "\t" // keep alignment with the tabs in the source line
+		} else {
+			indent += " "
+		}
+	}
+	width := 1
+	if end.Line == pos.Line && end.Column > pos.Column {
+		width = end.Column - pos.Column
+	}
+	return diag + "\n" + line + "\n" + indent + "^" + strings.Repeat("~", width-1)
+}
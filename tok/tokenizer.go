@@ -57,8 +57,13 @@
 package tok
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -70,6 +75,10 @@ const (
 	SymbolsEllipsis = "..."
 )
 
+// DefaultMaxErrors is the number of errors after which a recovering
+// tokenizer gives up, unless configured otherwise.
+const DefaultMaxErrors = 10
+
 type TokenType int
 const (
 	TypeFormStart TokenType = iota
@@ -82,210 +91,389 @@ const (
 type (
 	Token struct {
 		Type TokenType
-		Text string
-		Pos int
+		Text string // cooked text
+		Pos, End Position // [Pos, End) span of the token in the source
+		// Only set in lossless mode, concatenating Leading and Raw of all
+		// tokens reproduces the source exactly.
+		Leading string // trivia (white space, separators) before the token
+		Raw string // source of the token as written
+	}
+	// Position of a rune in a source file.
+	// Line and Column are 1-based, Column counts runes.
+	Position struct {
+		Source *Source
+		Line, Column int
+		Offset int // in runes
+		ByteOffset int
 	}
 	tokFunc func() tokFunc
+	// Tokenizer reads its input lazily, only ever holding on to the text of
+	// the token currently being tokenized (plus a few runes of lookahead).
 	Tokenizer struct {
+		r io.RuneReader
+		eof bool
+		readErr error // other than io.EOF
+		peeked []peekedRune
+		pos Position // position of the next (not yet consumed) rune
+		src *Source
+		text strings.Builder
+		pending []Token // tokenized, but not yet returned by Next
+		state tokFunc
+		err error // to be returned by Next
+		nerrs int
+		raw []rune // consumed source not yet attributed to a token (lossless mode)
+		rawStart int // offset of raw[0]
+
+		// Recover from errors by skipping ahead to the next form boundary
+		// or blank line, so that all errors of a document are reported at
+		// once.
+		Recover bool
+		// MaxErrors caps the number of errors reported in recovery mode
+		// (DefaultMaxErrors if <= 0).
+		MaxErrors int
+		// Lossless keeps the raw source and the trivia between tokens, see
+		// Token.Leading and Token.Raw.
+		Lossless bool
+	}
+	peekedRune struct {
+		r rune
+		size int // in bytes
+	}
+	// runeSliceReader feeds already decoded runes to the tokenizer.
+	runeSliceReader struct {
 		bs []rune
-		l int
 		pos int
-		tokens []Token
-		state tokFunc
-		err error
 	}
 	TokenError struct {
 		Msg string
-		Pos int
-		FileName string
+		Pos, End Position
 	}
 )
 
 func NewTokenizer(bs []rune) *Tokenizer {
-	return &Tokenizer{
-		bs: bs,
-		l: len(bs),
+	return NewSourceTokenizer("", bs, nil)
+}
+
+// NewSourceTokenizer creates a tokenizer for the source named name (a file
+// path, or something like `<stdin>`), and registers it with sources.
+// If sources is nil, the source is not registered anywhere.
+func NewSourceTokenizer(name string, bs []rune, sources *Sources) *Tokenizer {
+	var src *Source
+	if sources != nil {
+		src = sources.Add(name, bs)
+	} else {
+		src = NewSource(name, bs)
 	}
+	return newTokenizer(&runeSliceReader{bs: bs}, src)
 }
 
-func (t *Tokenizer) Tokenize() ([]Token, error) {
+// NewReaderTokenizer creates a tokenizer that consumes r as tokens are
+// requested with Next.
+// The source text is not retained, so diagnostics do not quote it.
+func NewReaderTokenizer(r io.Reader) *Tokenizer {
+	rr, ok := r.(io.RuneReader)
+	if !ok {
+		rr = bufio.NewReader(r)
+	}
+	return newTokenizer(rr, &Source{Name: "<reader>"})
+}
+
+func newTokenizer(r io.RuneReader, src *Source) *Tokenizer {
+	t := &Tokenizer{
+		r: r,
+		src: src,
+		pos: Position{Source: src, Line: 1, Column: 1},
+	}
 	t.state = t.tokTextOrForm // initial state [:init:]
-	for t.state != nil {
+	return t
+}
+
+// Tokenize is a convenience wrapper around Next, returning all tokens at
+// once.
+func (t *Tokenizer) Tokenize() (tokens []Token, err error) {
+	var errs []error
+	for {
+		token, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, errors.Join(errs...)
+}
+
+// Next returns the next token.
+// Syntax errors are returned as TokenError, after which tokenizing only
+// continues in recovery mode.
+// io.EOF is returned once there are no more tokens.
+func (t *Tokenizer) Next() (Token, error) {
+	for {
+		if len(t.pending) > 0 {
+			token := t.pending[0]
+			t.pending = t.pending[1:]
+			return token, nil
+		}
+		if t.err != nil {
+			err := t.err
+			t.err = nil
+			return Token{}, err
+		}
+		if t.state == nil {
+			return Token{}, io.EOF
+		}
 		t.skipWhitespace()
-		if t.pos >= t.l {
+		if t.atEOF() {
 			t.state = t.tokEOF
 		}
 		t.state = t.state()
+		if t.readErr != nil {
+			t.pending = nil
+			t.state = nil
+			t.err = t.readErr
+		}
 	}
-	return t.tokens, t.err
 }
 
-func (t *Tokenizer) tokError(err error) tokFunc {
+func (t *Tokenizer) emit(token Token) {
+	if t.Lossless {
+		lead, end := token.Pos.Offset-t.rawStart, token.End.Offset-t.rawStart
+		token.Leading = string(t.raw[:lead])
+		token.Raw = string(t.raw[lead:end])
+		t.raw = append(t.raw[:0], t.raw[end:]...) // keep what was consumed past the token (e.g., separators)
+		t.rawStart = token.End.Offset
+	}
+	t.pending = append(t.pending, token)
+}
+
+func (t *Tokenizer) tokError(err TokenError) tokFunc {
 	t.err = err
-	return nil
+	t.nerrs++
+	if !t.Recover {
+		return nil
+	}
+	maxErrors := t.MaxErrors
+	if maxErrors <= 0 {
+		maxErrors = DefaultMaxErrors
+	}
+	if t.nerrs >= maxErrors {
+		t.err = errors.Join(err, t.NewTokenError(fmt.Sprintf("too many errors (%d), giving up", t.nerrs)))
+		return nil
+	}
+	t.resync()
+	return t.tokNilOrTextOrForm
+}
+
+// resync skips ahead to the next form start, form end or blank line, where
+// tokenizing can safely continue.
+func (t *Tokenizer) resync() {
+	quoted := false
+	for r, ok := t.peek(0); ok; r, ok = t.peek(0) {
+		if r == SymbolEscape {
+			if next, _ := t.peek(1); next == SymbolRawString {
+				quoted = !quoted
+			}
+			t.advance()
+			t.advance() // never stop at an escaped character
+			continue
+		}
+		if !quoted {
+			if r == SymbolFormStart || r == SymbolFormEnd {
+				return
+			}
+			if r == '\n' && t.isBlankLine() {
+				return
+			}
+		}
+		t.advance()
+	}
+}
+
+// isBlankLine reports whether the line following the peeked newline contains
+// only whitespace.
+func (t *Tokenizer) isBlankLine() bool {
+	for i := 1; ; i++ {
+		r, ok := t.peek(i)
+		if !ok || r == '\n' {
+			return true
+		}
+		if !IsWhitespace(r) {
+			return false
+		}
+	}
 }
 
 func (t *Tokenizer) tokTextOrForm() tokFunc { // initial state [:init:]
-	if t.bs[t.pos] == SymbolFormStart {
+	if r, _ := t.peek(0); r == SymbolFormStart {
 		return t.tokForm
 	}
 	return t.tokText
 }
 
 func (t *Tokenizer) tokText() tokFunc { // parse text
-	// @todo: paragraphs
 	var (
-		textEnd = t.pos
-		lastPos = textEnd
+		start = t.pos
+		end Position
 		quoted = false
-		parsedText = ""
+		space = false // merge excessive white space into a single space
 	)
-outer_loop:
-	for textEnd < t.l && ((t.bs[textEnd] != SymbolFormEnd && t.bs[textEnd] != SymbolFormStart) || quoted) {
-		if !quoted {
-			if t.bs[textEnd] == ' ' { // merge excessive white space
-				parsedText += string(t.bs[lastPos:textEnd])
-				lastPos = textEnd + 1 // past space
-				textEnd = lastPos
-
-				for textEnd < t.l && t.bs[textEnd] == ' ' {
-					textEnd++
-				}
-				lastPos = textEnd
-
-				if textEnd < t.l && t.bs[textEnd] != '\n' && t.bs[textEnd] != SymbolFormEnd {
-					parsedText += " "
-					lastPos = textEnd
-				}
-			} else if t.bs[textEnd] == '\n' { // two newlines separate text blocks, lines divided by a single newline are joined
-				if textEnd+1 < t.l {
-					if t.bs[textEnd+1] == '\n' || t.bs[textEnd+1] == SymbolFormEnd {
-						break // this text block is finished [:text-block-finished:]
-						// @note: any further newlines are skipped in .Tokenize() by the call to .skipWhitespace()
-					} else {
-						// merge with next text block
-						parsedText += string(t.bs[lastPos:textEnd])
-						parsedText += " " // join with space
-						lastPos = textEnd + 1 // past \n
-						textEnd = lastPos
-					}
-				} else {
-					parsedText += string(t.bs[lastPos:textEnd])
-					lastPos = textEnd + 1
-					textEnd = lastPos
-				}
-			} else if t.bs[textEnd] == SymbolEscape {
-				if textEnd+1 < t.l {
-					esc := t.bs[textEnd+1]
-					switch esc {
-					case SymbolFormStart:
-						fallthrough
-					case SymbolFormEnd:
-						fallthrough
-					case SymbolEscape:
-						parsedText += string(t.bs[lastPos:textEnd])
-						lastPos = textEnd + 2 // past escaped chars
-						textEnd = lastPos
-						break outer_loop // this text block is finished [:text-block-finished:]
-					case SymbolRawString:
-						parsedText += string(t.bs[lastPos:textEnd])
-						lastPos = textEnd + 2 // past escaped char
-						textEnd += 2          // past escaped char
-						quoted = !quoted
-					default:
-						return t.tokError(t.NewTokenError(fmt.Sprintf("invalid escape character: `%s`", string(esc))))
-					}
-				} else {
-					return t.tokError(t.NewTokenError("unfinished escape character (did you mean `{backslash}`?)"))
+	t.text.Reset()
+	writeSpace := func() {
+		if space {
+			t.text.WriteRune(' ')
+			space = false
+		}
+	}
+	for {
+		end = t.pos
+		r, ok := t.peek(0)
+		if !ok {
+			break
+		}
+		if quoted {
+			if r == SymbolEscape {
+				if next, _ := t.peek(1); next == SymbolRawString {
+					t.advance()
+					t.advance()
+					quoted = false
+					continue
 				}
-			} else if t.bs[textEnd] == SymbolNbsp {
-				parsedText += string(t.bs[lastPos:textEnd])
-				parsedText += "\u00A0" // no-break space
-				lastPos = textEnd + 1  // past ~
-				textEnd = lastPos
-			} else if textEnd+2 < t.l && string(t.bs[textEnd:textEnd+3]) == SymbolsEllipsis {
-				parsedText += string(t.bs[lastPos:textEnd])
-				parsedText += "\u2026" // horizontal ellipsis
-				lastPos = textEnd + 3  // past ...
-				textEnd = lastPos
-			} else {
-				textEnd++
 			}
-		} else {
-			if t.bs[textEnd] == SymbolEscape && textEnd+1 < t.l && t.bs[textEnd+1] == SymbolRawString {
-				parsedText += string(t.bs[lastPos:textEnd])
-				lastPos = textEnd + 2
-				textEnd = lastPos
-				quoted = false
-			} else {
-				textEnd++
+			t.text.WriteRune(r)
+			t.advance()
+			continue
+		}
+		if r == SymbolFormStart {
+			writeSpace() // keep the space between text and a nested form
+			break
+		}
+		if r == SymbolFormEnd {
+			break
+		}
+		if r == ' ' {
+			space = true
+			t.advance()
+		} else if r == '\n' { // two newlines separate text blocks, lines divided by a single newline are joined
+			if next, _ := t.peek(1); next == '\n' || next == SymbolFormEnd {
+				break // this text block is finished [:text-block-finished:]
+				// @note: any further newlines are skipped in .Next() by the call to .skipWhitespace()
 			}
+			space = true // join with space
+			t.advance()
+		} else if r == SymbolEscape {
+			esc, ok := t.peek(1)
+			if !ok {
+				return t.tokError(t.NewTokenError("unfinished escape character (did you mean `{backslash}`?)"))
+			}
+			switch esc {
+			case SymbolFormStart:
+				fallthrough
+			case SymbolFormEnd:
+				fallthrough
+			case SymbolEscape:
+				writeSpace() // the space before the separator belongs to the text
+				t.advance()
+				t.advance()
+				return t.emitText(start, end) // this text block is finished [:text-block-finished:]
+			case SymbolRawString:
+				writeSpace()
+				t.advance()
+				t.advance()
+				quoted = true
+			default:
+				return t.tokError(t.newTokenError(fmt.Sprintf("invalid escape character: `%s`", string(esc)), 2))
+			}
+		} else if r == SymbolNbsp {
+			writeSpace()
+			t.text.WriteRune('\u00A0') // no-break space
+			t.advance()
+		} else if t.peekString(SymbolsEllipsis) {
+			writeSpace()
+			t.text.WriteRune('\u2026') // horizontal ellipsis
+			for range SymbolsEllipsis {
+				t.advance()
+			}
+		} else {
+			writeSpace()
+			t.text.WriteRune(r)
+			t.advance()
 		}
 	}
-	parsedText += string(t.bs[lastPos:textEnd])
-	t.tokens = append(t.tokens, Token{
+	return t.emitText(start, end)
+}
+
+func (t *Tokenizer) emitText(start, end Position) tokFunc {
+	t.emit(Token{
 		Type: TypeText,
-		Text: parsedText,
-		Pos: t.pos,
+		Text: t.text.String(),
+		Pos: start,
+		End: end,
 	})
-	t.pos = textEnd
-
 	return t.tokNilOrTextOrForm
 }
 
 func (t *Tokenizer) tokForm() tokFunc { // parse form start
-	t.tokens = append(t.tokens, Token{
+	start := t.pos
+	t.advance()
+	t.emit(Token{
 		Type: TypeFormStart,
 		Text: string(SymbolFormStart),
-		Pos: t.pos,
+		Pos: start,
+		End: t.pos,
 	})
-	t.pos++
 
 	return t.tokNilOrAtom
 }
 
 func (t *Tokenizer) tokNilOrAtom() tokFunc {
-	r := t.bs[t.pos]
+	r, _ := t.peek(0)
 	if r == SymbolFormStart {
 		return t.tokError(t.NewTokenError("cannot start form / expected atom or nil"))
 	}
 	if r == SymbolFormEnd {
 		return t.tokNil
 	}
-	if isAtomChar(r) {
+	if IsAtomChar(r) {
 		return t.tokAtom
 	}
 	return t.tokError(t.NewTokenError(fmt.Sprintf("invalid character: `%s` / expected nil or atom", string(r))))
 }
 
 func (t *Tokenizer) tokNil() tokFunc { // parse form end
-	t.tokens = append(t.tokens, Token{
+	start := t.pos
+	t.advance()
+	t.emit(Token{
 		Type: TypeFormEnd,
 		Text: string(SymbolFormEnd),
-		Pos: t.pos,
+		Pos: start,
+		End: t.pos,
 	})
-	t.pos++
 
 	return t.tokNilOrTextOrForm
 }
 
 func (t *Tokenizer) tokAtom() tokFunc { // parse atom
-	atomEnd := t.pos
-	for atomEnd < t.l && isAtomChar(t.bs[atomEnd]) {
-		atomEnd++
+	start := t.pos
+	t.text.Reset()
+	for r, ok := t.peek(0); ok && IsAtomChar(r); r, ok = t.peek(0) {
+		t.text.WriteRune(r)
+		t.advance()
 	}
-	t.tokens = append(t.tokens, Token{
+	t.emit(Token{
 		Type: TypeAtom,
-		Text: string(t.bs[t.pos:atomEnd]),
-		Pos: t.pos,
+		Text: t.text.String(),
+		Pos: start,
+		End: t.pos,
 	})
-	t.pos = atomEnd
 
 	return t.tokNilOrTextOrForm
 }
 
 func (t *Tokenizer) tokNilOrTextOrForm() tokFunc {
-	r := t.bs[t.pos]
+	r, _ := t.peek(0)
 	if r == SymbolFormEnd {
 		return t.tokNil
 	}
@@ -296,36 +484,116 @@ func (t *Tokenizer) tokNilOrTextOrForm() tokFunc {
 }
 
 func (t *Tokenizer) tokEOF() tokFunc {
-	t.tokens = append(
-		t.tokens,
-		Token{
-			Type: TypeFormStart,
-			Text: string(SymbolFormStart),
-			Pos: t.pos,
-		},
-		Token{
-			Type: TypeAtom,
-			Text: "eof",
-			Pos: t.pos,
-		},
-		Token{
-			Type: TypeFormEnd,
-			Text: string(SymbolFormEnd),
-			Pos: t.pos,
-		},
-	)
+	eof := t.pos
+	t.emit(Token{
+		Type: TypeFormStart,
+		Text: string(SymbolFormStart),
+		Pos: eof,
+		End: eof,
+	})
+	t.emit(Token{
+		Type: TypeAtom,
+		Text: "eof",
+		Pos: eof,
+		End: eof,
+	})
+	t.emit(Token{
+		Type: TypeFormEnd,
+		Text: string(SymbolFormEnd),
+		Pos: eof,
+		End: eof,
+	})
 
 	return nil
 }
 
 func (t *Tokenizer) skipWhitespace() {
-	for t.pos < t.l && isWhitespace(t.bs[t.pos]) {
-		// @todo: count line / column
-		t.pos++
+	for r, ok := t.peek(0); ok && IsWhitespace(r); r, ok = t.peek(0) {
+		t.advance()
 	}
 }
 
-func isWhitespace(r rune) bool {
+// peek returns the n-th rune after the current position without consuming
+// it, ok is false at the end of the input.
+func (t *Tokenizer) peek(n int) (r rune, ok bool) {
+	for len(t.peeked) <= n {
+		if t.eof {
+			return 0, false
+		}
+		r, size, err := t.r.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				t.readErr = err
+			}
+			t.eof = true
+			return 0, false
+		}
+		t.peeked = append(t.peeked, peekedRune{r, size})
+	}
+	return t.peeked[n].r, true
+}
+
+func (t *Tokenizer) peekString(s string) bool {
+	i := 0
+	for _, r := range s {
+		if p, ok := t.peek(i); !ok || p != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+func (t *Tokenizer) atEOF() bool {
+	_, ok := t.peek(0)
+	return !ok
+}
+
+// advance consumes the next rune.
+func (t *Tokenizer) advance() {
+	if _, ok := t.peek(0); !ok {
+		return
+	}
+	t.pos = t.pos.advance(t.peeked[0].r, t.peeked[0].size)
+	if t.Lossless {
+		t.raw = append(t.raw, t.peeked[0].r)
+	}
+	t.peeked = t.peeked[1:]
+}
+
+func (p Position) advance(r rune, size int) Position {
+	p.Offset++
+	p.ByteOffset += size
+	if r == '\n' {
+		p.Line++
+		p.Column = 1
+	} else {
+		p.Column++
+	}
+	return p
+}
+
+// Advance returns the position following s, which appears in the source at p.
+func (p Position) Advance(s string) Position {
+	for _, r := range s {
+		p = p.advance(r, utf8.RuneLen(r))
+	}
+	return p
+}
+
+func (r *runeSliceReader) ReadRune() (rune, int, error) {
+	if r.pos >= len(r.bs) {
+		return 0, 0, io.EOF
+	}
+	c := r.bs[r.pos]
+	r.pos++
+	if n := utf8.RuneLen(c); n > 0 {
+		return c, n, nil
+	}
+	return c, utf8.RuneLen(utf8.RuneError), nil // invalid runes are encoded as U+FFFD
+}
+
+func IsWhitespace(r rune) bool {
 	ws := []rune{' ', '\n', '\r', '\t', '\v', '\f'}
 	for _, w := range ws {
 		if r == w {
@@ -343,35 +611,64 @@ func isNum(r rune) bool {
 	return r >= '0' && r <= '9'
 }
 
-func isAtomChar(r rune) bool {
+// IsAtomChar reports whether r may appear in the name of a form.
+func IsAtomChar(r rune) bool {
 	return isAlphaLower(r) || isNum(r)
 }
 
 func (t *Tokenizer) NewTokenError(msg string) TokenError {
+	return t.newTokenError(msg, 1)
+}
+
+// newTokenError reports an error spanning the next n runes.
+func (t *Tokenizer) newTokenError(msg string, n int) TokenError {
+	end := t.pos
+	for i := 0; i < n && i < len(t.peeked); i++ {
+		end = end.advance(t.peeked[i].r, t.peeked[i].size)
+	}
 	return TokenError{
 		Msg: msg,
 		Pos: t.pos,
-		FileName: "@todo: implement",
+		End: end,
 	}
 }
 
 func (e TokenError) Error() string {
-	return fmt.Sprintf("%s[%d]: %s", e.FileName, e.Pos, e.Msg)
+	return FormatDiagnostic(e.Pos, e.End, e.Msg)
+}
+
+func (p Position) FileName() string {
+	if p.Source == nil {
+		return ""
+	}
+	return p.Source.Name
+}
+
+func (p Position) String() string {
+	if p.FileName() == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.FileName(), p.Line, p.Column)
+}
+
+// IsValid reports whether the position has been set.
+func (p Position) IsValid() bool {
+	return p.Line > 0
 }
 
 func (t Token) String() string {
 	switch (t.Type) {
 	case TypeFormStart:
-		return fmt.Sprintf("FormStart{%d: `%s`}", t.Pos, VisibleString(t.Text))
+		return fmt.Sprintf("FormStart{%s: `%s`}", t.Pos, VisibleString(t.Text))
 	case TypeAtom:
-		return fmt.Sprintf("Atom{%d: `%s`}", t.Pos, VisibleString(t.Text))
+		return fmt.Sprintf("Atom{%s: `%s`}", t.Pos, VisibleString(t.Text))
 	case TypeText:
-		return fmt.Sprintf("Text{%d: `%s`}", t.Pos, VisibleString(t.Text))
+		return fmt.Sprintf("Text{%s: `%s`}", t.Pos, VisibleString(t.Text))
 	case TypeFormEnd:
-		return fmt.Sprintf("FormEnd{%d: `%s`}", t.Pos, VisibleString(t.Text))
+		return fmt.Sprintf("FormEnd{%s: `%s`}", t.Pos, VisibleString(t.Text))
 	}
 	log.Fatalf("invalid token type: %v", t.Type)
-	return fmt.Sprintf("Invalid[%d]{%d: `%s`}", t.Type, t.Pos, VisibleString(t.Text))
+	return fmt.Sprintf("Invalid[%d]{%s: `%s`}", t.Type, t.Pos, VisibleString(t.Text))
 }
 
 func VisibleString(s string) string {
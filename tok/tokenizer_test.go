@@ -0,0 +1,133 @@
+package tok
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testdata/blog_example.tokens is the output of the tokenizer before it read
+// its input lazily, on testdata/blog_example.be.
+func TestTokenizeGolden(t *testing.T) {
+	src, err := os.ReadFile("testdata/blog_example.be")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("testdata/blog_example.tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := NewSourceTokenizer("blog_example.be", []rune(string(src)), nil).Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, token := range tokens {
+		got = append(got, token.String())
+	}
+	want := strings.Split(strings.TrimSuffix(string(golden), "\n"), "\n")
+	for i := range max(len(got), len(want)) {
+		if i >= len(got) || i >= len(want) || got[i] != want[i] {
+			t.Fatalf("token %d: want: %s, got: %s", i, at(want, i), at(got, i))
+		}
+	}
+
+	// reading from an io.Reader results in the same tokens
+	streamed, err := NewReaderTokenizer(strings.NewReader(string(src))).Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != len(tokens) {
+		t.Fatalf("reader: want: %d tokens, got: %d", len(tokens), len(streamed))
+	}
+	for i, token := range streamed {
+		want := tokens[i]
+		if token.Type != want.Type || token.Text != want.Text || token.Pos.Offset != want.Pos.Offset || token.End.Offset != want.End.Offset {
+			t.Fatalf("reader: token %d: want: %s, got: %s", i, want, token)
+		}
+	}
+}
+
+func at(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return "<none>"
+}
+
+func TestRecoverMaxErrors(t *testing.T) {
+	src := strings.Repeat("{em invalid \\q escape}\n", 20)
+	tests := []struct {
+		maxErrors, want int
+	}{
+		{0, DefaultMaxErrors},
+		{3, 3},
+		{50, 20},
+	}
+	for _, test := range tests {
+		tokenizer := NewTokenizer([]rune(src))
+		tokenizer.Recover = true
+		tokenizer.MaxErrors = test.maxErrors
+		_, err := tokenizer.Tokenize()
+		var errs []TokenError
+		collectTokenErrors(err, &errs)
+		gaveUp := len(errs) > 0 && strings.HasPrefix(errs[len(errs)-1].Msg, "too many errors")
+		if gaveUp {
+			errs = errs[:len(errs)-1]
+		}
+		if len(errs) != test.want {
+			t.Errorf("MaxErrors %d: want: %d errors, got: %d", test.maxErrors, test.want, len(errs))
+		}
+		if wantGiveUp := test.want < 20; gaveUp != wantGiveUp {
+			t.Errorf("MaxErrors %d: want: giving up %t, got: %t", test.maxErrors, wantGiveUp, gaveUp)
+		}
+	}
+}
+
+func collectTokenErrors(err error, errs *[]TokenError) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			collectTokenErrors(err, errs)
+		}
+		return
+	}
+	var tokErr TokenError
+	if errors.As(err, &tokErr) {
+		*errs = append(*errs, tokErr)
+	}
+}
+
+func TestLosslessRoundTrip(t *testing.T) {
+	example, err := os.ReadFile("testdata/blog_example.be")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []string{
+		string(example),
+		"",
+		"  \n\n",
+		"{title Hello~World...}",
+		"text \\\\ separated\n\nby a blank line\n",
+		"{code \\+\n\traw {string}\n\\+}\n",
+		"{em escaped \\{ braces \\}}  \n\t",
+		"{paragraph {em a}{em b}   {em c}}\n\n\n",
+	}
+	for _, src := range tests {
+		tokenizer := NewTokenizer([]rune(src))
+		tokenizer.Lossless = true
+		tokens, err := tokenizer.Tokenize()
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		var sb strings.Builder
+		for _, token := range tokens {
+			sb.WriteString(token.Leading)
+			sb.WriteString(token.Raw)
+		}
+		if got := sb.String(); got != src {
+			t.Errorf("want: %q, got: %q", src, got)
+		}
+	}
+}